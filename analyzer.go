@@ -0,0 +1,501 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/infrago/infra"
+)
+
+const (
+	AnalyzerStandard   = "standard"
+	AnalyzerSimple     = "simple"
+	AnalyzerWhitespace = "whitespace"
+	AnalyzerKeyword    = "keyword"
+	AnalyzerEnglish    = "english"
+)
+
+type (
+	// Token is one analyzed term, Start/End are byte offsets into the text
+	// produced by the char filters.
+	Token struct {
+		Term     string
+		Position int
+		Start    int
+		End      int
+	}
+
+	CharFilter interface {
+		Filter(text string) string
+	}
+
+	Tokenizer interface {
+		Tokenize(text string) []Token
+	}
+
+	TokenFilter interface {
+		Filter(tokens []Token) []Token
+	}
+
+	CharFilterFunc  func(text string) string
+	TokenizerFunc   func(text string) []Token
+	TokenFilterFunc func(tokens []Token) []Token
+
+	// Analyzer turns text into terms: char filters, then a tokenizer, then
+	// token filters, in that order.
+	Analyzer struct {
+		Name         string
+		Desc         string
+		CharFilters  []CharFilter
+		Tokenizer    Tokenizer
+		TokenFilters []TokenFilter
+	}
+
+	Analyzers map[string]Analyzer
+)
+
+func (f CharFilterFunc) Filter(text string) string      { return f(text) }
+func (f TokenizerFunc) Tokenize(text string) []Token    { return f(text) }
+func (f TokenFilterFunc) Filter(tokens []Token) []Token { return f(tokens) }
+
+// languageAnalyzers maps Index.Language to a built-in analyzer.
+var languageAnalyzers = map[string]string{
+	"en":      AnalyzerEnglish,
+	"english": AnalyzerEnglish,
+}
+
+func init() {
+	module.RegisterAnalyzers(Analyzers{
+		AnalyzerStandard: {
+			Desc:         "unicode letter/number tokens, lowercased and ascii folded",
+			Tokenizer:    StandardTokenizer{},
+			TokenFilters: []TokenFilter{LowercaseFilter{}, ASCIIFoldingFilter{}},
+		},
+		AnalyzerSimple: {
+			Desc:         "unicode letter/number tokens, lowercased",
+			Tokenizer:    StandardTokenizer{},
+			TokenFilters: []TokenFilter{LowercaseFilter{}},
+		},
+		AnalyzerWhitespace: {
+			Desc:      "whitespace separated tokens, as is",
+			Tokenizer: WhitespaceTokenizer{},
+		},
+		AnalyzerKeyword: {
+			Desc:      "the whole text as one token",
+			Tokenizer: KeywordTokenizer{},
+		},
+		AnalyzerEnglish: {
+			Desc:      "standard analyzer with english stop words and stemming",
+			Tokenizer: StandardTokenizer{},
+			TokenFilters: []TokenFilter{
+				LowercaseFilter{}, ASCIIFoldingFilter{},
+				NewStopFilter(englishStopWords...), EnglishStemFilter{},
+			},
+		},
+	})
+}
+
+func (m *Module) RegisterAnalyzer(name string, analyzer Analyzer) {
+	m.analyzerMutex.Lock()
+	defer m.analyzerMutex.Unlock()
+
+	if name == "" {
+		name = infra.DEFAULT
+	}
+	if analyzer.Tokenizer == nil {
+		panic("invalid search analyzer: " + name)
+	}
+	analyzer.Name = name
+	if infra.Override() {
+		m.analyzers[name] = analyzer
+	} else if _, ok := m.analyzers[name]; !ok {
+		m.analyzers[name] = analyzer
+	}
+}
+
+func (m *Module) RegisterAnalyzers(analyzers Analyzers) {
+	for name, analyzer := range analyzers {
+		m.RegisterAnalyzer(name, analyzer)
+	}
+}
+
+// Analyzer returns a registered analyzer by name.
+func (m *Module) Analyzer(name string) (Analyzer, bool) {
+	m.analyzerMutex.RLock()
+	defer m.analyzerMutex.RUnlock()
+	return m.analyzerLocked(name)
+}
+
+func (m *Module) analyzerLocked(name string) (Analyzer, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Analyzer{}, false
+	}
+	analyzer, ok := m.analyzers[name]
+	return analyzer, ok
+}
+
+// IndexAnalyzer resolves the analyzer of an index: Index.Analyzer first,
+// then Index.Language, then the standard analyzer, with Index.StopWords
+// added to it.
+func (m *Module) IndexAnalyzer(index Index) Analyzer {
+	m.analyzerMutex.RLock()
+	defer m.analyzerMutex.RUnlock()
+	return m.indexAnalyzerLocked(index).WithStopWords(index.StopWords...)
+}
+
+func (m *Module) indexAnalyzerLocked(index Index) Analyzer {
+	if analyzer, ok := m.analyzerLocked(index.Analyzer); ok {
+		return analyzer
+	}
+	lang := strings.ToLower(strings.TrimSpace(index.Language))
+	if analyzer, ok := m.analyzerLocked(lang); ok {
+		return analyzer
+	}
+	if analyzer, ok := m.analyzerLocked(languageAnalyzers[lang]); ok {
+		return analyzer
+	}
+	if analyzer, ok := m.analyzerLocked(AnalyzerStandard); ok {
+		return analyzer
+	}
+	return Analyzer{Name: AnalyzerStandard, Tokenizer: StandardTokenizer{}, TokenFilters: []TokenFilter{LowercaseFilter{}}}
+}
+
+// Analyze runs the analyzer of a registered index over text.
+func (m *Module) Analyze(index, text string) []Token {
+	m.mutex.RLock()
+	idx, ok := m.indexes[index]
+	m.mutex.RUnlock()
+	if !ok {
+		idx = Index{Name: index}
+	}
+	return m.IndexAnalyzer(idx).Analyze(text)
+}
+
+// checkAnalyzersLocked makes sure every analyzer referenced by an index is
+// registered, the caller holds m.mutex.
+func (m *Module) checkAnalyzersLocked() error {
+	for name, index := range m.indexes {
+		if index.Analyzer != "" {
+			if _, ok := m.Analyzer(index.Analyzer); !ok {
+				return fmt.Errorf("search index %s uses unknown analyzer %s", name, index.Analyzer)
+			}
+		}
+		for _, field := range index.Schema {
+			if field.Analyzer == "" {
+				continue
+			}
+			if _, ok := m.Analyzer(field.Analyzer); !ok {
+				return fmt.Errorf("search index %s field %s uses unknown analyzer %s", name, field.Name, field.Analyzer)
+			}
+		}
+	}
+	return nil
+}
+
+// Analyze runs the analyzer over text.
+func (a Analyzer) Analyze(text string) []Token {
+	return a.tokenize(a.filter(text))
+}
+
+// filter applies the char filters only, token offsets refer to its output.
+func (a Analyzer) filter(text string) string {
+	for _, filter := range a.CharFilters {
+		if filter != nil {
+			text = filter.Filter(text)
+		}
+	}
+	return text
+}
+
+func (a Analyzer) tokenize(text string) []Token {
+	tokenizer := a.Tokenizer
+	if tokenizer == nil {
+		tokenizer = StandardTokenizer{}
+	}
+	tokens := tokenizer.Tokenize(text)
+	for _, filter := range a.TokenFilters {
+		if filter != nil {
+			tokens = filter.Filter(tokens)
+		}
+	}
+	out := tokens[:0]
+	for _, token := range tokens {
+		if token.Term != "" {
+			out = append(out, token)
+		}
+	}
+	return out
+}
+
+// Terms runs the analyzer over text and returns the terms only.
+func (a Analyzer) Terms(text string) []string {
+	tokens := a.Analyze(text)
+	out := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		out = append(out, token.Term)
+	}
+	return out
+}
+
+// StandardTokenizer splits text into runs of unicode letters and numbers.
+type StandardTokenizer struct{}
+
+func (StandardTokenizer) Tokenize(text string) []Token {
+	return splitTokens(text, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.Mn, r)
+	})
+}
+
+// WhitespaceTokenizer splits text on whitespace.
+type WhitespaceTokenizer struct{}
+
+func (WhitespaceTokenizer) Tokenize(text string) []Token {
+	return splitTokens(text, func(r rune) bool { return !unicode.IsSpace(r) })
+}
+
+// KeywordTokenizer emits the whole text as one token.
+type KeywordTokenizer struct{}
+
+func (KeywordTokenizer) Tokenize(text string) []Token {
+	if strings.TrimSpace(text) == "" {
+		return []Token{}
+	}
+	return []Token{{Term: text, Position: 0, Start: 0, End: len(text)}}
+}
+
+func splitTokens(text string, keep func(rune) bool) []Token {
+	tokens := make([]Token, 0)
+	start := -1
+	for i, r := range text {
+		if keep(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, Token{Term: text[start:i], Position: len(tokens), Start: start, End: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, Token{Term: text[start:], Position: len(tokens), Start: start, End: len(text)})
+	}
+	return tokens
+}
+
+// LowercaseFilter lowercases every term.
+type LowercaseFilter struct{}
+
+func (LowercaseFilter) Filter(tokens []Token) []Token {
+	for i := range tokens {
+		tokens[i].Term = strings.ToLower(tokens[i].Term)
+	}
+	return tokens
+}
+
+// ASCIIFoldingFilter folds latin letters with diacritics into plain ascii.
+type ASCIIFoldingFilter struct{}
+
+func (ASCIIFoldingFilter) Filter(tokens []Token) []Token {
+	for i := range tokens {
+		tokens[i].Term = foldASCII(tokens[i].Term)
+	}
+	return tokens
+}
+
+var asciiFolding = func() map[rune]string {
+	table := map[string]string{
+		"àáâãäåāăą": "a", "çćĉċč": "c", "ďđ": "d", "èéêëēĕėęě": "e",
+		"ĝğġģ": "g", "ĥħ": "h", "ìíîïĩīĭįı": "i", "ĵ": "j", "ķ": "k",
+		"ĺļľŀł": "l", "ñńņňŉ": "n", "òóôõöøōŏő": "o", "ŕŗř": "r",
+		"śŝşš": "s", "ţťŧ": "t", "ùúûüũūŭůűų": "u", "ŵ": "w", "ýÿŷ": "y",
+		"źżž": "z", "ß": "ss", "æ": "ae", "œ": "oe", "þ": "th", "ð": "d",
+	}
+	out := map[rune]string{}
+	for from, to := range table {
+		for _, r := range from {
+			out[r] = to
+			if upper := unicode.ToUpper(r); upper != r {
+				out[upper] = strings.ToUpper(to)
+			}
+		}
+	}
+	return out
+}()
+
+func foldASCII(s string) string {
+	folded := false
+	for _, r := range s {
+		if r >= utf8.RuneSelf {
+			if _, ok := asciiFolding[r]; ok {
+				folded = true
+				break
+			}
+		}
+	}
+	if !folded {
+		return s
+	}
+	var sb strings.Builder
+	for _, r := range s {
+		if to, ok := asciiFolding[r]; ok {
+			sb.WriteString(to)
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// StopFilter drops stop words, positions of the remaining tokens are kept
+// so that phrase distances stay correct.
+type StopFilter struct {
+	Words map[string]struct{}
+}
+
+func NewStopFilter(words ...string) StopFilter {
+	set := make(map[string]struct{}, len(words))
+	for _, word := range words {
+		set[strings.ToLower(word)] = struct{}{}
+	}
+	return StopFilter{Words: set}
+}
+
+func (f StopFilter) Filter(tokens []Token) []Token {
+	out := tokens[:0]
+	for _, token := range tokens {
+		if _, ok := f.Words[token.Term]; ok {
+			continue
+		}
+		out = append(out, token)
+	}
+	return out
+}
+
+// EnglishStemFilter is a light english stemmer that removes plural and
+// common verb suffixes (porter step 1).
+type EnglishStemFilter struct{}
+
+func (EnglishStemFilter) Filter(tokens []Token) []Token {
+	for i := range tokens {
+		tokens[i].Term = stemEnglish(tokens[i].Term)
+	}
+	return tokens
+}
+
+func stemEnglish(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+	for _, r := range word {
+		if r >= utf8.RuneSelf || !unicode.IsLetter(r) {
+			return word
+		}
+	}
+
+	// plurals
+	switch {
+	case strings.HasSuffix(word, "sses"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "ies"):
+		word = word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"), strings.HasSuffix(word, "is"):
+	case strings.HasSuffix(word, "s"):
+		word = word[:len(word)-1]
+	}
+
+	// past tense and gerunds
+	switch {
+	case strings.HasSuffix(word, "eed"):
+		if stemMeasure(word[:len(word)-3]) > 0 {
+			word = word[:len(word)-1]
+		}
+	case strings.HasSuffix(word, "ed") && stemHasVowel(word[:len(word)-2]):
+		word = stemRestore(word[:len(word)-2])
+	case strings.HasSuffix(word, "ing") && stemHasVowel(word[:len(word)-3]) && len(word) > 5:
+		word = stemRestore(word[:len(word)-3])
+	}
+
+	// terminal y
+	if strings.HasSuffix(word, "y") && len(word) > 2 && stemHasVowel(word[:len(word)-1]) {
+		word = word[:len(word)-1] + "i"
+	}
+	return word
+}
+
+func stemRestore(word string) string {
+	switch {
+	case strings.HasSuffix(word, "at"), strings.HasSuffix(word, "bl"), strings.HasSuffix(word, "iz"):
+		return word + "e"
+	}
+	n := len(word)
+	if n >= 2 && word[n-1] == word[n-2] && !stemVowel(word, n-1) {
+		switch word[n-1] {
+		case 'l', 's', 'z':
+		default:
+			return word[:n-1]
+		}
+	}
+	if stemMeasure(word) == 1 && stemCVC(word) {
+		return word + "e"
+	}
+	return word
+}
+
+func stemVowel(word string, i int) bool {
+	switch word[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return true
+	case 'y':
+		return i > 0 && !stemVowel(word, i-1)
+	}
+	return false
+}
+
+func stemHasVowel(word string) bool {
+	for i := range word {
+		if stemVowel(word, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// stemMeasure counts vowel-consonant sequences.
+func stemMeasure(word string) int {
+	m := 0
+	prevVowel := false
+	for i := range word {
+		vowel := stemVowel(word, i)
+		if prevVowel && !vowel {
+			m++
+		}
+		prevVowel = vowel
+	}
+	return m
+}
+
+func stemCVC(word string) bool {
+	n := len(word)
+	if n < 3 {
+		return false
+	}
+	if stemVowel(word, n-1) || !stemVowel(word, n-2) || stemVowel(word, n-3) {
+		return false
+	}
+	switch word[n-1] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+var englishStopWords = []string{
+	"a", "an", "and", "are", "as", "at", "be", "but", "by", "for", "if", "in",
+	"into", "is", "it", "no", "not", "of", "on", "or", "such", "that", "the",
+	"their", "then", "there", "these", "they", "this", "to", "was", "will", "with",
+}
@@ -0,0 +1,245 @@
+package search
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const AnalyzerCJK = "cjk"
+
+type (
+	// Dictionary is a word list used by the CJK tokenizer for maximum
+	// matching, single character words such as particles are kept apart
+	// instead of being joined into bigrams. It is safe to extend at runtime,
+	// documents indexed before a change keep their old segmentation until
+	// they are written again.
+	Dictionary struct {
+		mutex  sync.RWMutex
+		words  map[string]struct{}
+		maxLen int
+	}
+
+	// CJKTokenizer segments han/kana/hangul runs with forward maximum
+	// matching against a dictionary, unknown runs fall back to overlapping
+	// bigrams, other scripts are split like the standard tokenizer.
+	// Fine also emits the dictionary words nested inside a matched word at
+	// the same position, so "电话" can find "移动电话".
+	CJKTokenizer struct {
+		Dictionary *Dictionary
+		Fine       bool
+	}
+)
+
+var defaultDictionary = NewDictionary(cjkWords...)
+
+func init() {
+	for _, lang := range []string{"zh", "zh-cn", "zh-hans", "zh-tw", "zh-hant", "chinese", "ja", "japanese", "ko", "korean", "cjk"} {
+		languageAnalyzers[lang] = AnalyzerCJK
+	}
+	stops := make([]string, 0)
+	for _, lang := range []string{"zh", "ja", "ko"} {
+		stops = append(stops, StopWords(lang)...)
+	}
+	defaultDictionary.Add(stops...)
+	module.RegisterAnalyzer(AnalyzerCJK, Analyzer{
+		Desc:         "dictionary based cjk segmentation with bigram fallback and cjk stop words",
+		Tokenizer:    CJKTokenizer{Fine: true},
+		TokenFilters: []TokenFilter{LowercaseFilter{}, ASCIIFoldingFilter{}, NewStopFilter(stops...)},
+	})
+}
+
+func NewDictionary(words ...string) *Dictionary {
+	dict := &Dictionary{words: map[string]struct{}{}}
+	dict.Add(words...)
+	return dict
+}
+
+// Add puts words into the dictionary.
+func (d *Dictionary) Add(words ...string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		if word == "" {
+			continue
+		}
+		d.words[word] = struct{}{}
+		if n := utf8.RuneCountInString(word); n > d.maxLen {
+			d.maxLen = n
+		}
+	}
+}
+
+// Contains reports whether word is in the dictionary.
+func (d *Dictionary) Contains(word string) bool {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	_, ok := d.words[word]
+	return ok
+}
+
+// cjkRune is a rune with its byte offsets in the source text.
+type cjkRune struct {
+	start int
+	end   int
+}
+
+func (t CJKTokenizer) Tokenize(text string) []Token {
+	dict := t.Dictionary
+	if dict == nil {
+		dict = defaultDictionary
+	}
+	dict.mutex.RLock()
+	defer dict.mutex.RUnlock()
+
+	tokens := make([]Token, 0)
+	position := 0
+	emit := func(start, end int, nested bool) {
+		pos := position
+		if nested && len(tokens) > 0 {
+			pos = tokens[len(tokens)-1].Position
+		} else {
+			position++
+		}
+		tokens = append(tokens, Token{Term: text[start:end], Position: pos, Start: start, End: end})
+	}
+
+	run := make([]cjkRune, 0)
+	wordStart := -1
+	flushWord := func(end int) {
+		if wordStart >= 0 {
+			emit(wordStart, end, false)
+			wordStart = -1
+		}
+	}
+	flushRun := func() {
+		if len(run) > 0 {
+			t.segment(text, run, dict, emit)
+			run = run[:0]
+		}
+	}
+
+	for i, r := range text {
+		end := i + utf8.RuneLen(r)
+		switch {
+		case isCJK(r):
+			flushWord(i)
+			run = append(run, cjkRune{start: i, end: end})
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.Mn, r):
+			flushRun()
+			if wordStart < 0 {
+				wordStart = i
+			}
+		default:
+			flushRun()
+			flushWord(i)
+		}
+	}
+	flushRun()
+	flushWord(len(text))
+	return tokens
+}
+
+func (t CJKTokenizer) segment(text string, run []cjkRune, dict *Dictionary, emit func(start, end int, nested bool)) {
+	word := func(from, to int) string {
+		return text[run[from].start:run[to-1].end]
+	}
+	unknown := -1
+	flushUnknown := func(to int) {
+		if unknown < 0 {
+			return
+		}
+		if to-unknown == 1 {
+			emit(run[unknown].start, run[unknown].end, false)
+		} else {
+			for i := unknown; i+1 < to; i++ {
+				emit(run[i].start, run[i+1].end, false)
+			}
+		}
+		unknown = -1
+	}
+
+	for i := 0; i < len(run); {
+		n := 0
+		for l := min(dict.maxLen, len(run)-i); l >= 1; l-- {
+			if _, ok := dict.words[word(i, i+l)]; ok {
+				n = l
+				break
+			}
+		}
+		if n == 0 {
+			if unknown < 0 {
+				unknown = i
+			}
+			i++
+			continue
+		}
+		flushUnknown(i)
+		emit(run[i].start, run[i+n-1].end, false)
+		if t.Fine {
+			for a := i; a < i+n; a++ {
+				for b := a + 2; b <= i+n; b++ {
+					if a == i && b == i+n {
+						continue
+					}
+					if _, ok := dict.words[word(a, b)]; ok {
+						emit(run[a].start, run[b-1].end, true)
+					}
+				}
+			}
+		}
+		i += n
+	}
+	flushUnknown(len(run))
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// AddWords extends the built-in CJK dictionary with user words.
+func (m *Module) AddWords(words ...string) {
+	defaultDictionary.Add(words...)
+}
+
+var cjkWords = []string{
+	// 通用
+	"我们", "你们", "他们", "她们", "它们", "自己", "大家", "什么", "怎么", "怎样",
+	"为什么", "哪里", "那里", "这里", "这个", "那个", "这些", "那些", "一个", "一些",
+	"没有", "不是", "就是", "还是", "但是", "因为", "所以", "如果", "虽然", "而且",
+	"或者", "以及", "已经", "正在", "可以", "可能", "应该", "需要", "必须", "能够",
+	"现在", "今天", "明天", "昨天", "时候", "时间", "以后", "以前", "之后", "之前",
+	"今年", "明年", "去年", "小时", "分钟", "星期", "周末", "上午", "下午", "晚上",
+	"中国", "北京", "上海", "广州", "深圳", "香港", "台湾", "世界", "国家", "城市",
+	"地方", "地区", "全国", "国际", "国内", "海外", "亚洲", "欧洲", "美国", "日本",
+	"人们", "人民", "朋友", "孩子", "父母", "家庭", "学生", "老师", "学校", "大学",
+	"公司", "企业", "工作", "员工", "老板", "客户", "用户", "会员", "团队", "部门",
+	"问题", "方法", "办法", "情况", "结果", "原因", "目的", "意思", "东西", "事情",
+	"发展", "经济", "社会", "文化", "历史", "政治", "科学", "技术", "科技", "教育",
+	"健康", "医疗", "医院", "医生", "生活", "环境", "安全", "服务", "管理", "市场",
+	"价格", "产品", "商品", "质量", "品牌", "销售", "购买", "支付", "订单", "物流",
+	"快递", "配送", "退款", "退货", "优惠", "折扣", "促销", "活动", "免费", "包邮",
+	"新闻", "消息", "信息", "文章", "内容", "标题", "作者", "评论", "视频", "图片",
+	"音乐", "电影", "电视", "电视机", "游戏", "体育", "足球", "篮球", "旅游", "美食",
+	// 数码
+	"手机", "电话", "移动", "移动电话", "智能", "智能手机", "电脑", "笔记本", "笔记本电脑", "平板",
+	"平板电脑", "耳机", "蓝牙", "充电", "充电器", "电池", "屏幕", "键盘", "鼠标", "相机",
+	"摄像头", "手表", "智能手表", "显示器", "路由器", "网络", "无线", "数据", "数据库", "存储",
+	"硬盘", "内存", "芯片", "处理器", "系统", "操作系统", "软件", "硬件", "应用", "程序",
+	// 技术
+	"互联网", "计算机", "编程", "开发", "开发者", "代码", "源码", "开源", "框架", "模块",
+	"驱动", "接口", "配置", "参数", "函数", "变量", "类型", "对象", "数组",
+	"字符串", "服务器", "客户端", "前端", "后端", "云计算", "人工智能", "机器学习", "深度学习", "算法",
+	"搜索", "搜索引擎", "引擎", "索引", "检索", "查询", "排序", "过滤", "分页", "高亮",
+	"分词", "词典", "文档", "字段", "缓存", "队列", "日志", "监控", "部署", "测试",
+	"性能", "优化", "版本", "更新", "升级", "安装", "下载", "上传", "登录", "注册",
+	"账号", "密码", "权限", "设置", "功能", "页面", "网站", "网页", "平台", "工具",
+	// 常用动词形容词
+	"喜欢", "希望", "知道", "认为", "觉得", "发现", "开始", "结束", "继续", "提供",
+	"支持", "使用", "利用", "进行", "通过", "关于", "对于", "根据", "包括", "成为",
+	"重要", "主要", "基本", "一般", "特别", "非常", "比较", "简单", "复杂", "容易",
+	"快速", "高效", "稳定", "可靠", "方便", "实用", "专业", "最新", "热门", "推荐",
+}
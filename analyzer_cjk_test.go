@@ -0,0 +1,67 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/infrago/base"
+)
+
+func TestCJKTokenizer(t *testing.T) {
+	cjk, _ := module.Analyzer(AnalyzerCJK)
+	cases := []struct {
+		text   string
+		tokens string
+	}{
+		// dictionary words, nested words at the same position
+		{"移动电话", "[{移动电话 0 0 12} {移动 0 0 6} {电话 0 6 12}]"},
+		// unknown runs fall back to bigrams
+		{"鑫淼科技", "[{鑫淼 0 0 6} {科技 1 6 12}]"},
+		// other scripts are split and folded, single runes are kept
+		{"iPhone手机壳", "[{iphone 0 0 6} {手机 1 6 12} {壳 2 12 15}]"},
+		// stop words are dropped, their position is kept
+		{"我的手机", "[{我 0 0 3} {手机 2 6 12}]"},
+	}
+	for _, one := range cases {
+		if got := fmt.Sprint(cjk.Analyze(one.text)); got != one.tokens {
+			t.Errorf("tokens of %q = %s, want %s", one.text, got, one.tokens)
+		}
+	}
+
+	coarse := CJKTokenizer{}
+	if got := fmt.Sprint(coarse.Tokenize("移动电话")); got != "[{移动电话 0 0 12}]" {
+		t.Fatalf("coarse tokens %s", got)
+	}
+}
+
+func TestCJKDictionary(t *testing.T) {
+	dict := NewDictionary("鑫淼")
+	tokenizer := CJKTokenizer{Dictionary: dict}
+	if got := fmt.Sprint(tokenizer.Tokenize("鑫淼科技")); got != "[{鑫淼 0 0 6} {科技 1 6 12}]" {
+		t.Fatalf("tokens %s", got)
+	}
+	dict.Add(" 鑫淼科技 ", "")
+	if !dict.Contains("鑫淼科技") || dict.Contains("") {
+		t.Fatal("words are not trimmed")
+	}
+	if got := fmt.Sprint(tokenizer.Tokenize("鑫淼科技")); got != "[{鑫淼科技 0 0 12}]" {
+		t.Fatalf("tokens after Add %s", got)
+	}
+}
+
+func TestCJKSearch(t *testing.T) {
+	c := newConn(t)
+	c.SyncIndex("z", Index{Language: "zh"})
+	c.Upsert("z", []Map{{"id": "1", "title": "我想买一部移动电话"}, {"id": "2", "title": "电视机很好"}})
+	res, err := c.Search("z", BuildQuery("电话", Map{"$highlight": "title"}))
+	if err != nil || res.Total != 1 || res.Hits[0].ID != "1" {
+		t.Fatalf("matched %v %v", res.Hits, err)
+	}
+	if title := fmt.Sprint(res.Hits[0].Payload["title"]); !strings.Contains(title, "<em>电话</em>") {
+		t.Fatalf("highlighted %s", title)
+	}
+	if res, _ := c.Search("z", BuildQuery("移动电话")); res.Total != 1 {
+		t.Fatalf("compound word matched %v", res.Hits)
+	}
+}
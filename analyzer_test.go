@@ -0,0 +1,102 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/infrago/base"
+)
+
+func TestAnalyzerTokens(t *testing.T) {
+	standard, _ := module.Analyzer(AnalyzerStandard)
+	text := "Café au-lait, 2 CUPS"
+	tokens := standard.Analyze(text)
+	want := []Token{
+		{Term: "cafe", Position: 0, Start: 0, End: 5},
+		{Term: "au", Position: 1, Start: 6, End: 8},
+		{Term: "lait", Position: 2, Start: 9, End: 13},
+		{Term: "2", Position: 3, Start: 15, End: 16},
+		{Term: "cups", Position: 4, Start: 17, End: 21},
+	}
+	if fmt.Sprint(tokens) != fmt.Sprint(want) {
+		t.Fatalf("standard tokens %v, want %v", tokens, want)
+	}
+
+	cases := []struct {
+		analyzer string
+		text     string
+		terms    string
+	}{
+		{AnalyzerSimple, "Café au-lait", "café au lait"},
+		{AnalyzerWhitespace, "Café au-lait", "Café au-lait"},
+		{AnalyzerKeyword, "Café au-lait", "Café au-lait"},
+		{AnalyzerEnglish, "The Running dogs are hoping", "run dog hope"},
+		{AnalyzerEnglish, "agreed ponies caresses", "agree poni caress"},
+	}
+	for _, one := range cases {
+		analyzer, ok := module.Analyzer(one.analyzer)
+		if !ok {
+			t.Fatalf("analyzer %s is not registered", one.analyzer)
+		}
+		if got := strings.Join(analyzer.Terms(one.text), " "); got != one.terms {
+			t.Errorf("%s terms of %q = %q, want %q", one.analyzer, one.text, got, one.terms)
+		}
+	}
+}
+
+func TestIndexAnalyzer(t *testing.T) {
+	cases := []struct {
+		index Index
+		name  string
+	}{
+		{Index{}, AnalyzerStandard},
+		{Index{Language: "EN"}, AnalyzerEnglish},
+		{Index{Language: "en", Analyzer: AnalyzerKeyword}, AnalyzerKeyword},
+		{Index{Analyzer: "missing", Language: "klingon"}, AnalyzerStandard},
+	}
+	for _, one := range cases {
+		if got := module.IndexAnalyzer(one.index).Name; got != one.name {
+			t.Errorf("IndexAnalyzer(%+v) = %s, want %s", one.index, got, one.name)
+		}
+	}
+}
+
+func TestRegisterAnalyzer(t *testing.T) {
+	m := &Module{analyzers: map[string]Analyzer{}, indexes: map[string]Index{}}
+	m.RegisterAnalyzer("upper", Analyzer{
+		Tokenizer: WhitespaceTokenizer{},
+		TokenFilters: []TokenFilter{TokenFilterFunc(func(tokens []Token) []Token {
+			for i := range tokens {
+				tokens[i].Term = strings.ToUpper(tokens[i].Term)
+			}
+			return tokens
+		})},
+	})
+	analyzer, ok := m.Analyzer("upper")
+	if !ok || analyzer.Name != "upper" || strings.Join(analyzer.Terms("a b"), " ") != "A B" {
+		t.Fatalf("registered analyzer %+v %v", analyzer, ok)
+	}
+
+	m.indexes["docs"] = Index{Analyzer: "missing"}
+	if err := m.checkAnalyzersLocked(); err == nil || !strings.Contains(err.Error(), "unknown analyzer missing") {
+		t.Fatalf("checkAnalyzers = %v, want an unknown analyzer error", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("an analyzer without tokenizer was registered")
+		}
+	}()
+	m.RegisterAnalyzer("broken", Analyzer{})
+}
+
+func TestAnalyzerSearch(t *testing.T) {
+	c := newConn(t)
+	c.SyncIndex("e", Index{Language: "en"})
+	c.Upsert("e", []Map{{"id": "1", "title": "the dogs were running"}, {"id": "2", "title": "a cat"}})
+	res, err := c.Search("e", BuildQuery("DOG run"))
+	if err != nil || res.Total != 1 || res.Hits[0].ID != "1" {
+		t.Fatalf("stemmed search matched %v %v", res.Hits, err)
+	}
+}
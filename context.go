@@ -0,0 +1,132 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/infrago/base"
+)
+
+// TimeoutError is returned when an operation misses its deadline, from
+// Config.Timeout or the caller's context. It matches
+// context.DeadlineExceeded with errors.Is.
+type TimeoutError struct {
+	Op      string
+	Index   string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Timeout > 0 {
+		return fmt.Sprintf("%s on search index %s timed out after %s", e.Op, e.Index, e.Timeout)
+	}
+	return fmt.Sprintf("%s on search index %s timed out", e.Op, e.Index)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// run calls fn with ctx bounded by the instance timeout, and reports a
+// missed deadline as a TimeoutError.
+func (inst *Instance) run(ctx context.Context, op, index string, fn func(context.Context) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	parent, timeout := ctx, inst.Config.Timeout
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err := ctx.Err()
+	if err == nil {
+		err = fn(ctx)
+	}
+	if err != nil && errors.Is(err, context.DeadlineExceeded) {
+		var te *TimeoutError
+		if errors.As(err, &te) {
+			return err
+		}
+		// only report the configured timeout when it is what expired.
+		if parent.Err() != nil {
+			timeout = 0
+		}
+		return &TimeoutError{Op: op, Index: index, Timeout: timeout}
+	}
+	return err
+}
+
+// await runs fn for connections that do not take a context, returning
+// when the context is done even though fn keeps running.
+func await[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	if ctx.Done() == nil {
+		return fn()
+	}
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := fn()
+		done <- result{value, err}
+	}()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+func connClear(ctx context.Context, conn Connection, index string) error {
+	if cc, ok := conn.(ContextConnection); ok {
+		return cc.ClearContext(ctx, index)
+	}
+	_, err := await(ctx, func() (struct{}, error) {
+		return struct{}{}, conn.Clear(index)
+	})
+	return err
+}
+
+func connUpsert(ctx context.Context, conn Connection, index string, rows []Map) error {
+	if cc, ok := conn.(ContextConnection); ok {
+		return cc.UpsertContext(ctx, index, rows)
+	}
+	_, err := await(ctx, func() (struct{}, error) {
+		return struct{}{}, conn.Upsert(index, rows)
+	})
+	return err
+}
+
+func connDelete(ctx context.Context, conn Connection, index string, ids []string) error {
+	if cc, ok := conn.(ContextConnection); ok {
+		return cc.DeleteContext(ctx, index, ids)
+	}
+	_, err := await(ctx, func() (struct{}, error) {
+		return struct{}{}, conn.Delete(index, ids)
+	})
+	return err
+}
+
+func connSearch(ctx context.Context, conn Connection, index string, query Query) (Result, error) {
+	if cc, ok := conn.(ContextConnection); ok {
+		return cc.SearchContext(ctx, index, query)
+	}
+	return await(ctx, func() (Result, error) {
+		return conn.Search(index, query)
+	})
+}
+
+func connCount(ctx context.Context, conn Connection, index string, query Query) (int64, error) {
+	if cc, ok := conn.(ContextConnection); ok {
+		return cc.CountContext(ctx, index, query)
+	}
+	return await(ctx, func() (int64, error) {
+		return conn.Count(index, query)
+	})
+}
@@ -0,0 +1,84 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/infrago/base"
+)
+
+// slowConn answers searches after delay, without taking a context.
+type slowConn struct {
+	Connection
+	delay time.Duration
+}
+
+func (s slowConn) Search(index string, query Query) (Result, error) {
+	time.Sleep(s.delay)
+	return Result{Total: 1}, nil
+}
+
+func TestRunTimeout(t *testing.T) {
+	inst := &Instance{Name: "a", Config: Config{Timeout: 20 * time.Millisecond}, conn: slowConn{newConn(t), 100 * time.Millisecond}}
+	search := func(ctx context.Context) error {
+		_, err := connSearch(ctx, inst.conn, "x", Query{})
+		return err
+	}
+
+	start := time.Now()
+	err := inst.run(context.Background(), "search", "x", search)
+	var te *TimeoutError
+	if !errors.As(err, &te) || te.Timeout != 20*time.Millisecond || te.Op != "search" || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("%v, want a TimeoutError of 20ms", err)
+	}
+	if took := time.Since(start); took > 80*time.Millisecond {
+		t.Fatalf("returned after %s, the call was waited for", took)
+	}
+
+	// the caller's deadline is reported without the configured timeout
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	err = inst.run(ctx, "search", "x", search)
+	if !errors.As(err, &te) || te.Timeout != 0 {
+		t.Fatalf("%v, want a TimeoutError without timeout", err)
+	}
+
+	// cancellation is not a timeout
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := inst.run(ctx, "search", "x", search); !errors.Is(err, context.Canceled) || errors.As(err, &te) {
+		t.Fatalf("%v, want context.Canceled", err)
+	}
+
+	inst.conn = slowConn{newConn(t), 0}
+	if err := inst.run(context.Background(), "search", "x", search); err != nil {
+		t.Fatalf("fast call failed: %v", err)
+	}
+}
+
+func TestSearchContext(t *testing.T) {
+	c := newConn(t)
+	c.Upsert("x", []Map{{"id": "1", "title": "hello"}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.SearchContext(ctx, "x", Query{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("default driver searched with a canceled context: %v", err)
+	}
+
+	m := &Module{
+		instances: map[string]*Instance{"a": {Name: "a", Config: Config{Timeout: 20 * time.Millisecond}, conn: slowConn{c, 100 * time.Millisecond}}},
+		indexes:   map[string]Index{},
+	}
+	if _, err := m.SearchContext(context.Background(), "x", "hello"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("%v, want the instance timeout", err)
+	}
+	if _, err := m.SearchContext(ctx, "x", "hello"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("%v, want context.Canceled", err)
+	}
+	m.instances["a"].conn = c
+	if res, err := m.SearchContext(context.Background(), "x", "hello"); err != nil || res.Total != 1 {
+		t.Fatalf("%+v %v", res, err)
+	}
+}
@@ -0,0 +1,68 @@
+package search
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/infrago/base"
+)
+
+// DefaultScroll is how long a scroll is kept between pages when it is
+// enabled with $scroll: true.
+const DefaultScroll = time.Minute
+
+// Cursor is the decoded form of Query.Cursor and Result.Cursor. Values and
+// ID are the sort values and ID of the last hit of a page (search_after),
+// Scroll and Offset a position in a result set kept by the driver.
+type Cursor struct {
+	Values []Any  `json:"v,omitempty"`
+	ID     string `json:"id,omitempty"`
+	Scroll string `json:"s,omitempty"`
+	Offset int    `json:"o,omitempty"`
+}
+
+// EncodeCursor returns the opaque form of a cursor.
+func EncodeCursor(cursor Cursor) string {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor returned by EncodeCursor, numbers come back
+// as int64 or float64 and dates as RFC3339 strings.
+func DecodeCursor(s string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid search cursor")
+	}
+	var cursor Cursor
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&cursor); err != nil {
+		return Cursor{}, fmt.Errorf("invalid search cursor")
+	}
+	for i, v := range cursor.Values {
+		cursor.Values[i] = normalizeStored(v)
+	}
+	return cursor, nil
+}
+
+// parseScroll accepts true, a duration like "5m" or seconds.
+func parseScroll(v Any) time.Duration {
+	if b, ok := v.(bool); ok {
+		if b {
+			return DefaultScroll
+		}
+		return 0
+	}
+	if d := parseDuration(v); d > 0 {
+		return d
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/infrago/base"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	when := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	cursor, err := DecodeCursor(EncodeCursor(Cursor{Values: []Any{3, 1.5, "b", when}, ID: "42"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.ID != "42" || len(cursor.Values) != 4 {
+		t.Fatalf("decoded %+v", cursor)
+	}
+	if _, ok := cursor.Values[0].(int64); !ok {
+		t.Fatalf("integer decoded as %T", cursor.Values[0])
+	}
+	if cmp, ok := compareTimes(cursor.Values[3], when); !ok || cmp != 0 {
+		t.Fatalf("date decoded as %v", cursor.Values[3])
+	}
+	if _, err := DecodeCursor("!!"); err == nil {
+		t.Fatal("invalid cursor decoded")
+	}
+}
+
+func TestCursorPaging(t *testing.T) {
+	c := newConn(t)
+	rows := make([]Map, 0, 25)
+	for i := range 25 {
+		rows = append(rows, Map{"id": fmt.Sprintf("%02d", i), "rank": i % 5, "when": time.Unix(int64(1000+i), 0), "title": "doc"})
+	}
+	c.Upsert("p", rows)
+
+	seen := map[string]bool{}
+	cursor, pages := "", 0
+	for {
+		res, err := c.Search("p", BuildQuery("doc", Map{"$sort": "-rank,when", "$limit": 7, "$cursor": cursor}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		for _, hit := range res.Hits {
+			if seen[hit.ID] {
+				t.Fatalf("%s returned twice", hit.ID)
+			}
+			seen[hit.ID] = true
+		}
+		if pages == 1 {
+			// a document sorting before the cursor does not shift the pages
+			c.Upsert("p", []Map{{"id": "zz", "rank": 9, "title": "doc"}})
+		}
+		if res.Cursor == "" {
+			break
+		}
+		cursor = res.Cursor
+	}
+	if len(seen) != 25 || pages != 4 {
+		t.Fatalf("paged %d hits in %d pages, want 25 in 4", len(seen), pages)
+	}
+
+	if _, err := c.Search("p", BuildQuery("", Map{"$cursor": "!!"})); err == nil {
+		t.Fatal("invalid cursor accepted")
+	}
+	first, _ := c.Search("p", BuildQuery("", Map{"$sort": "rank", "$limit": 1}))
+	if _, err := c.Search("p", BuildQuery("", Map{"$sort": "rank,when", "$cursor": first.Cursor})); err == nil {
+		t.Fatal("cursor of other sorts accepted")
+	}
+}
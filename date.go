@@ -0,0 +1,217 @@
+package search
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/infrago/base"
+)
+
+// dateLayouts are the string formats recognized as dates.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseDate converts the values that are dates by themselves. Numbers are
+// only dates when compared with one, see compareTimes, and relative dates
+// such as "now-7d" only on the query side, see resolveNow.
+func parseDate(v Any) (time.Time, bool) {
+	switch vv := v.(type) {
+	case time.Time:
+		return vv, true
+	case *time.Time:
+		if vv == nil {
+			return time.Time{}, false
+		}
+		return *vv, true
+	case string:
+		s := strings.TrimSpace(vv)
+		if len(s) < 10 || s[4] != '-' {
+			return time.Time{}, false
+		}
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// unixTime treats numbers as unix seconds, or milliseconds when too large
+// to be seconds.
+func unixTime(v Any) (time.Time, bool) {
+	var n float64
+	switch vv := v.(type) {
+	case int:
+		n = float64(vv)
+	case int64:
+		n = float64(vv)
+	case float64:
+		n = vv
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(vv), 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		n = f
+	default:
+		return time.Time{}, false
+	}
+	if n > 1e11 || n < -1e11 {
+		return time.UnixMilli(int64(n)), true
+	}
+	sec := int64(n)
+	return time.Unix(sec, int64((n-float64(sec))*1e9)), true
+}
+
+// parseRelativeTime parses "now", "now-7d", "now+1h-30m" and rounding like
+// "now-1d/d", units are y M w d h m s.
+func parseRelativeTime(s string, now time.Time) (time.Time, bool) {
+	expr := strings.TrimPrefix(s, "now")
+	t := now
+	for expr != "" {
+		sign := expr[0]
+		if sign == '/' {
+			if len(expr) != 2 {
+				return time.Time{}, false
+			}
+			return roundTime(t, expr[1])
+		}
+		if sign != '+' && sign != '-' {
+			return time.Time{}, false
+		}
+		i := 1
+		for i < len(expr) && expr[i] >= '0' && expr[i] <= '9' {
+			i++
+		}
+		if i == 1 || i >= len(expr) {
+			return time.Time{}, false
+		}
+		n, _ := strconv.Atoi(expr[1:i])
+		if sign == '-' {
+			n = -n
+		}
+		switch expr[i] {
+		case 'y':
+			t = t.AddDate(n, 0, 0)
+		case 'M':
+			t = t.AddDate(0, n, 0)
+		case 'w':
+			t = t.AddDate(0, 0, 7*n)
+		case 'd':
+			t = t.AddDate(0, 0, n)
+		case 'h':
+			t = t.Add(time.Duration(n) * time.Hour)
+		case 'm':
+			t = t.Add(time.Duration(n) * time.Minute)
+		case 's':
+			t = t.Add(time.Duration(n) * time.Second)
+		default:
+			return time.Time{}, false
+		}
+		expr = expr[i+1:]
+	}
+	return t, true
+}
+
+func roundTime(t time.Time, unit byte) (time.Time, bool) {
+	y, mon, d := t.Date()
+	switch unit {
+	case 'y':
+		return time.Date(y, 1, 1, 0, 0, 0, 0, t.Location()), true
+	case 'M':
+		return time.Date(y, mon, 1, 0, 0, 0, 0, t.Location()), true
+	case 'w':
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, mon, d-offset, 0, 0, 0, 0, t.Location()), true
+	case 'd':
+		return time.Date(y, mon, d, 0, 0, 0, 0, t.Location()), true
+	case 'h':
+		return t.Truncate(time.Hour), true
+	case 'm':
+		return t.Truncate(time.Minute), true
+	case 's':
+		return t.Truncate(time.Second), true
+	}
+	return time.Time{}, false
+}
+
+// compareTimes compares two values as dates when at least one of them is
+// a date by itself, the other one may then also be a unix timestamp.
+func compareTimes(a, b Any) (int, bool) {
+	ta, oka := parseDate(a)
+	tb, okb := parseDate(b)
+	if !oka && !okb {
+		return 0, false
+	}
+	if !oka {
+		ta, oka = unixTime(a)
+	}
+	if !okb {
+		tb, okb = unixTime(b)
+	}
+	if !oka || !okb {
+		return 0, false
+	}
+	return ta.Compare(tb), true
+}
+
+// resolveNow returns the query with the relative dates of its comparison
+// filters and range facets resolved against now, so that every document
+// is compared with the same instant, and a "now" in a document is just a
+// string. Unnamed ranges keep the key of their
+// relative bounds.
+func resolveNow(query Query, now time.Time) Query {
+	query.Filters = resolveFilters(query.Filters, now)
+	if len(query.RangeFacets) > 0 {
+		facets := make([]RangeFacet, len(query.RangeFacets))
+		for i, rf := range query.RangeFacets {
+			ranges := make([]FacetRange, len(rf.Ranges))
+			for j, r := range rf.Ranges {
+				ranges[j] = FacetRange{Key: facetRangeKey(r), From: resolveDate(r.From, now), To: resolveDate(r.To, now)}
+			}
+			facets[i] = RangeFacet{Field: rf.Field, Ranges: ranges}
+		}
+		query.RangeFacets = facets
+	}
+	return query
+}
+
+func resolveFilters(filters []Filter, now time.Time) []Filter {
+	if len(filters) == 0 {
+		return filters
+	}
+	out := make([]Filter, len(filters))
+	for i, f := range filters {
+		switch normalizeFilterOp(f.Op) {
+		case FilterEq, FilterNe, FilterGt, FilterGte, FilterLt, FilterLte, FilterRange:
+			f.Value, f.Min, f.Max = resolveDate(f.Value, now), resolveDate(f.Min, now), resolveDate(f.Max, now)
+		case FilterIn, FilterNin:
+			values := make([]Any, len(f.Values))
+			for j, v := range f.Values {
+				values[j] = resolveDate(v, now)
+			}
+			f.Values = values
+		}
+		f.Filters = resolveFilters(f.Filters, now)
+		out[i] = f
+	}
+	return out
+}
+
+// resolveDate turns a relative date into a time, other values are kept.
+func resolveDate(v Any, now time.Time) Any {
+	if s, ok := v.(string); ok && strings.HasPrefix(strings.TrimSpace(s), "now") {
+		if t, ok := parseRelativeTime(strings.TrimSpace(s), now); ok {
+			return t
+		}
+	}
+	return v
+}
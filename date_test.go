@@ -0,0 +1,153 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/infrago/base"
+)
+
+func TestParseRelativeTime(t *testing.T) {
+	now := time.Date(2024, 3, 13, 15, 4, 5, 0, time.UTC)
+	cases := map[string]time.Time{
+		"now":         now,
+		"now-7d":      now.AddDate(0, 0, -7),
+		"now+1h-30m":  now.Add(30 * time.Minute),
+		"now-1M":      now.AddDate(0, -1, 0),
+		"now-1d/d":    time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC),
+		"now/w":       time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC),
+		"now/y":       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		"now-2w/h":    time.Date(2024, 2, 28, 15, 0, 0, 0, time.UTC),
+		"now+10s/m":   time.Date(2024, 3, 13, 15, 4, 0, 0, time.UTC),
+		"now-1y+2M/M": time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for expr, want := range cases {
+		got, ok := parseRelativeTime(expr, now)
+		if !ok || !got.Equal(want) {
+			t.Errorf("parseRelativeTime(%q) = %v %v, want %v", expr, got, ok, want)
+		}
+	}
+	for _, expr := range []string{"now-", "now-d", "now-1x", "now/", "now/dd", "now*2d", "nowadays"} {
+		if got, ok := parseRelativeTime(expr, now); ok {
+			t.Errorf("parseRelativeTime(%q) = %v, want an error", expr, got)
+		}
+	}
+}
+
+func TestCompareTimes(t *testing.T) {
+	when := time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		a, b Any
+		cmp  int
+		ok   bool
+	}{
+		{when, "2024-03-13", 0, true},
+		{"2024-03-13T00:00:00Z", when.Unix(), 0, true},
+		{when.UnixMilli(), "2024-03-12", 1, true},
+		{"2001-01-02", "now", 0, false},
+		{"now-1d", "now", 0, false},
+		{5, 7, 0, false},
+		{"abc", "2024-03-13", 0, false},
+	}
+	for _, one := range cases {
+		cmp, ok := compareTimes(one.a, one.b)
+		if cmp != one.cmp || ok != one.ok {
+			t.Errorf("compareTimes(%v, %v) = %d %v, want %d %v", one.a, one.b, cmp, ok, one.cmp, one.ok)
+		}
+	}
+	// relative dates are resolved on the query side only
+	if compareEqual("now/d", "now-0d/d") {
+		t.Fatal("relative dates compared as dates")
+	}
+}
+
+func TestResolveNow(t *testing.T) {
+	now := time.Date(2024, 3, 13, 15, 4, 5, 0, time.UTC)
+	query := Query{
+		Filters: []Filter{
+			{Field: "published", Op: FilterGt, Value: "now-7d"},
+			{Field: "title", Op: FilterPrefix, Value: "now"},
+			{Op: FilterOr, Filters: []Filter{{Field: "at", Op: FilterIn, Values: []Any{"now", "x"}}}},
+		},
+		RangeFacets: []RangeFacet{{Field: "published", Ranges: []FacetRange{{From: "now-7d"}, {Key: "older", To: "now-7d"}}}},
+	}
+	got := resolveNow(query, now)
+	week := now.AddDate(0, 0, -7)
+	if v, ok := got.Filters[0].Value.(time.Time); !ok || !v.Equal(week) {
+		t.Fatalf("gt filter resolved to %v", got.Filters[0].Value)
+	}
+	if got.Filters[1].Value != "now" {
+		t.Fatalf("prefix filter resolved to %v", got.Filters[1].Value)
+	}
+	if v, ok := got.Filters[2].Filters[0].Values[0].(time.Time); !ok || !v.Equal(now) || got.Filters[2].Filters[0].Values[1] != "x" {
+		t.Fatalf("nested in filter resolved to %v", got.Filters[2].Filters[0].Values)
+	}
+	ranges := got.RangeFacets[0].Ranges
+	if ranges[0].Key != "now-7d~*" || ranges[1].Key != "older" {
+		t.Fatalf("range keys %q %q", ranges[0].Key, ranges[1].Key)
+	}
+	if v, ok := ranges[1].To.(time.Time); !ok || !v.Equal(week) {
+		t.Fatalf("range bound resolved to %v", ranges[1].To)
+	}
+	if query.Filters[0].Value != "now-7d" || query.RangeFacets[0].Ranges[0].From != "now-7d" {
+		t.Fatal("resolveNow changed the query it was given")
+	}
+}
+
+func TestDateSearch(t *testing.T) {
+	c := newConn(t)
+	now := time.Now()
+	c.Upsert("d", []Map{
+		{"id": "1", "published": now.Add(-time.Hour)},
+		{"id": "2", "published": now.AddDate(0, 0, -3).Format(time.RFC3339)},
+		{"id": "3", "published": now.AddDate(0, 0, -30).Unix()},
+		{"id": "4", "published": "2001-01-02"},
+	})
+	res, err := c.Search("d", BuildQuery("", Map{"published": Map{"$gt": "now-7d"}}))
+	if err != nil || res.Total != 2 {
+		t.Fatalf("now-7d matched %v %v, want 2", res.Hits, err)
+	}
+	res, _ = c.Search("d", BuildQuery("", Map{"published": Map{"$range": Map{"min": "2000-01-01", "max": "now-7d/d"}}}))
+	if res.Total != 2 {
+		t.Fatalf("range matched %v, want 2", res.Hits)
+	}
+
+	res, _ = c.Search("d", BuildQuery("", Map{
+		"$sort":   Map{"published": DESC},
+		"$ranges": Map{"published": []Map{{"key": "week", "from": "now-7d"}, {"to": "now-7d"}}},
+	}))
+	ids := ""
+	for _, hit := range res.Hits {
+		ids += hit.ID
+	}
+	if ids != "1234" {
+		t.Fatalf("sorted by date as %s, want 1234", ids)
+	}
+	counts := map[string]int64{}
+	for _, facet := range res.Facets["published"] {
+		counts[facet.Value] = facet.Count
+	}
+	if counts["week"] != 2 || counts["*~now-7d"] != 2 {
+		t.Fatalf("range facets %v", res.Facets["published"])
+	}
+}
+
+func TestDatePayloadNow(t *testing.T) {
+	c := newConn(t)
+	c.Upsert("d", []Map{
+		{"id": "1", "published": "now"},
+		{"id": "2", "published": "now-1d"},
+		{"id": "3", "published": time.Now().Add(-time.Hour)},
+	})
+	res, err := c.Search("d", BuildQuery("", Map{"published": Map{"$gt": "now-7d"}}))
+	if err != nil || res.Total != 1 || res.Hits[0].ID != "3" {
+		t.Fatalf("now-7d matched %v %v, want 3", res.Hits, err)
+	}
+	res, _ = c.Search("d", BuildQuery("", Map{"published": "now-1d"}))
+	if res.Total != 0 {
+		t.Fatalf("relative date matched the string %v", res.Hits)
+	}
+	if !FilterMatch(Filter{Field: "p", Op: FilterGt, Value: "now-1d"}, Map{"p": time.Now()}) {
+		t.Fatal("FilterMatch did not resolve a relative date")
+	}
+}
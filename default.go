@@ -1,8 +1,9 @@
 package search
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"os"
 	"sort"
 	"strings"
 	"sync"
@@ -16,12 +17,13 @@ type defaultDriver struct{}
 
 type defaultConnection struct {
 	mutex   sync.RWMutex
+	prefix  string
 	indexes map[string]*memoryIndex
-}
+	store   *diskStore
 
-type memoryIndex struct {
-	name string
-	docs map[string]Map
+	scrollMutex sync.Mutex
+	scrolls     map[string]*scrollState
+	maxScrolls  int
 }
 
 func init() {
@@ -29,42 +31,106 @@ func init() {
 }
 
 func (d *defaultDriver) Connect(inst *Instance) (Connection, error) {
-	return &defaultConnection{indexes: make(map[string]*memoryIndex)}, nil
+	store, err := newDiskStore(inst.Setting)
+	if err != nil {
+		return nil, err
+	}
+	maxScrolls := DefaultMaxScrolls
+	if v, ok := toInt(inst.Setting["max_scrolls"]); ok && v > 0 {
+		maxScrolls = v
+	}
+	return &defaultConnection{
+		prefix: inst.Config.Prefix, indexes: make(map[string]*memoryIndex), store: store, maxScrolls: maxScrolls,
+	}, nil
+}
+
+func (c *defaultConnection) Open() error {
+	if c.store == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.startStore()
+}
+
+func (c *defaultConnection) Close() error {
+	c.scrollMutex.Lock()
+	c.scrolls = nil
+	c.scrollMutex.Unlock()
+	if c.store == nil {
+		return nil
+	}
+	return c.stopStore()
+}
+
+// Ping checks that the store directory is still there, memory only
+// connections are always up.
+func (c *defaultConnection) Ping() error {
+	if c.store == nil {
+		return nil
+	}
+	if _, err := os.Stat(c.store.path); err != nil {
+		return fmt.Errorf("search store unavailable: %w", err)
+	}
+	return nil
 }
 
-func (c *defaultConnection) Open() error  { return nil }
-func (c *defaultConnection) Close() error { return nil }
 func (c *defaultConnection) Capabilities() Capabilities {
 	return Capabilities{
-		SyncIndex: true,
-		Clear:     true,
-		Upsert:    true,
-		Delete:    true,
-		Search:    true,
-		Count:     true,
-		Suggest:   false,
-		Sort:      true,
-		Facets:    true,
-		Highlight: true,
-		FilterOps: []string{OpEq, OpNe, OpIn, OpNin, OpGt, OpGte, OpLt, OpLte, OpRange},
+		SyncIndex:    true,
+		Clear:        true,
+		Upsert:       true,
+		Delete:       true,
+		Search:       true,
+		Count:        true,
+		Suggest:      true,
+		Sort:         true,
+		Facets:       true,
+		Highlight:    true,
+		SearchFields: true,
+		BoolFilters:  true,
+		RangeFacets:  true,
+		Fuzzy:        true,
+		Phrases:      true,
+		TermClauses:  true,
+		Cursor:       true,
+		Scroll:       true,
+		FilterOps: []string{
+			OpEq, OpNe, OpIn, OpNin, OpGt, OpGte, OpLt, OpLte, OpRange,
+			FilterExists, FilterMissing, FilterPrefix, FilterContains, FilterWildcard, FilterRegex, FilterText,
+		},
 	}
 }
 
 func (c *defaultConnection) SyncIndex(name string, index Index) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	if _, ok := c.indexes[name]; !ok {
-		c.indexes[name] = &memoryIndex{name: name, docs: map[string]Map{}}
+	idx, ok := c.indexes[name]
+	if !ok {
+		idx = newMemoryIndex(strings.TrimPrefix(name, c.prefix), module.IndexAnalyzer(index))
+		c.indexes[name] = idx
 	}
+	idx.mutex.Lock()
+	idx.configure(index)
+	idx.mutex.Unlock()
 	return nil
 }
 
 func (c *defaultConnection) Clear(name string) error {
+	return c.ClearContext(context.Background(), name)
+}
+
+func (c *defaultConnection) ClearContext(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	if idx, ok := c.indexes[name]; ok && idx != nil {
-		idx.docs = map[string]Map{}
+	record := storeRecord{Op: "clear", Index: name}
+	if err := c.logLocked(record); err != nil {
+		return err
 	}
+	c.applyLocked(record)
 	return nil
 }
 
@@ -72,40 +138,100 @@ func (c *defaultConnection) ensure(index string) *memoryIndex {
 	if idx, ok := c.indexes[index]; ok {
 		return idx
 	}
-	idx := &memoryIndex{name: index, docs: map[string]Map{}}
+	idx := newMemoryIndex(strings.TrimPrefix(index, c.prefix), module.IndexAnalyzer(Index{Name: index}))
 	c.indexes[index] = idx
 	return idx
 }
 
 func (c *defaultConnection) Upsert(index string, rows []Map) error {
+	return c.UpsertContext(context.Background(), index, rows)
+}
+
+// UpsertContext checks the context before the write only, writes are
+// applied in memory and are not interrupted.
+func (c *defaultConnection) UpsertContext(ctx context.Context, index string, rows []Map) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	idx := c.ensure(index)
-	for _, row := range rows {
-		if row == nil {
-			continue
-		}
-		id := fmt.Sprintf("%v", row["id"])
-		if id == "" || id == "<nil>" {
-			continue
-		}
-		idx.docs[id] = cloneMap(row)
+	record := storeRecord{Op: "upsert", Index: index, Rows: rows}
+	if err := c.logLocked(record); err != nil {
+		return err
 	}
+	c.applyLocked(record)
 	return nil
 }
 
 func (c *defaultConnection) Delete(index string, ids []string) error {
+	return c.DeleteContext(context.Background(), index, ids)
+}
+
+func (c *defaultConnection) DeleteContext(ctx context.Context, index string, ids []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	idx := c.ensure(index)
-	for _, id := range ids {
-		delete(idx.docs, id)
+	record := storeRecord{Op: "delete", Index: index, IDs: ids}
+	if err := c.logLocked(record); err != nil {
+		return err
 	}
+	c.applyLocked(record)
 	return nil
 }
 
+// applyLocked applies a write, logged or replayed, the caller holds c.mutex.
+func (c *defaultConnection) applyLocked(record storeRecord) {
+	if record.Op == "clear" {
+		if idx, ok := c.indexes[record.Index]; ok && idx != nil {
+			idx.mutex.Lock()
+			idx.reset()
+			idx.mutex.Unlock()
+		}
+		return
+	}
+	idx := c.ensure(record.Index)
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	for _, row := range record.Rows {
+		if row == nil {
+			continue
+		}
+		id := fmt.Sprintf("%v", row["id"])
+		if id == "" || id == "<nil>" {
+			continue
+		}
+		idx.put(id, cloneMap(row))
+	}
+	for _, id := range record.IDs {
+		idx.remove(id)
+	}
+}
+
 func (c *defaultConnection) Search(index string, query Query) (Result, error) {
+	return c.SearchContext(context.Background(), index, query)
+}
+
+// SearchContext checks the context between matching, sorting and
+// presenting the hits.
+func (c *defaultConnection) SearchContext(ctx context.Context, index string, query Query) (Result, error) {
 	start := time.Now()
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	var cursor Cursor
+	if query.Cursor != "" {
+		var err error
+		if cursor, err = DecodeCursor(query.Cursor); err != nil {
+			return Result{}, err
+		}
+		if cursor.Scroll != "" {
+			return c.scrollPage(index, query, cursor, start)
+		}
+	}
+	c.purgeScrolls()
 
 	c.mutex.RLock()
 	idx := c.indexes[index]
@@ -114,16 +240,34 @@ func (c *defaultConnection) Search(index string, query Query) (Result, error) {
 		return Result{Hits: []Hit{}, Facets: map[string][]Facet{}}, nil
 	}
 
+	idx.prepare()
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	if err := checkFilters(query.Filters); err != nil {
+		return Result{}, err
+	}
+	if err := idx.checkQuery(query); err != nil {
+		return Result{}, err
+	}
+	query = resolveNow(query, start)
+
 	matched := make([]Hit, 0)
-	keyword := strings.ToLower(strings.TrimSpace(query.Keyword))
+	keyword, phrases := searchTerms(query)
 
-	for id, payload := range idx.docs {
-		if !defaultKeywordMatch(keyword, payload, query.Prefix) {
-			continue
-		}
+	candidates := idx.match(keyword, query.Prefix, query.Fuzzy, query.SearchFields)
+	if len(phrases) > 0 {
+		candidates = idx.matchPhrases(phrases, query.SearchFields, candidates, keyword == "")
+	}
+	if len(query.Should) > 0 {
+		candidates = idx.matchShould(candidates, query.Should, query.Prefix, query.Fuzzy, query.SearchFields, keyword == "" && len(phrases) == 0)
+	}
+	idx.exclude(candidates, query.Excluded, query.SearchFields)
+	for id, score := range candidates {
+		payload := idx.docs[id]
 		ok := true
 		for _, f := range query.Filters {
-			if !FilterMatch(f, payload) {
+			if !matchFilter(f, payload, idx.fieldAnalyzer) {
 				ok = false
 				break
 			}
@@ -131,25 +275,37 @@ func (c *defaultConnection) Search(index string, query Query) (Result, error) {
 		if !ok {
 			continue
 		}
-		matched = append(matched, Hit{ID: id, Score: 1.0, Payload: cloneMap(payload)})
+		// payloads are shared until paged, documents are replaced and
+		// never changed in place.
+		matched = append(matched, Hit{ID: id, Score: score, Payload: payload})
 	}
 
-	if len(query.Sorts) > 0 {
-		sort.SliceStable(matched, func(i, j int) bool {
-			for _, s := range query.Sorts {
-				ai := matched[i].Payload[s.Field]
-				aj := matched[j].Payload[s.Field]
-				cmp := compareForSort(ai, aj)
-				if cmp == 0 {
-					continue
-				}
-				if s.Desc {
-					return cmp > 0
-				}
-				return cmp < 0
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	sorts := query.Sorts
+	if len(sorts) == 0 {
+		sorts = []Sort{{Field: SortScore, Desc: true}}
+	}
+	keys := make(map[string][]Any, len(matched))
+	for _, hit := range matched {
+		vals := make([]Any, len(sorts))
+		for n, s := range sorts {
+			if s.Field == SortScore {
+				vals[n] = hit.Score
+			} else {
+				vals[n] = pathValue(hit.Payload, s.Field, s.Desc)
 			}
-			return matched[i].ID < matched[j].ID
-		})
+		}
+		keys[hit.ID] = vals
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return compareSortKeys(sorts, keys[matched[i].ID], matched[i].ID, keys[matched[j].ID], matched[j].ID) < 0
+	})
+
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
 	}
 
 	facets := map[string][]Facet{}
@@ -157,7 +313,16 @@ func (c *defaultConnection) Search(index string, query Query) (Result, error) {
 		for _, field := range query.Facets {
 			counter := map[string]int64{}
 			for _, hit := range matched {
-				counter[fmt.Sprintf("%v", hit.Payload[field])]++
+				values, _ := resolvePath(hit.Payload, field)
+				seen := make(map[string]struct{}, len(values))
+				for _, v := range values {
+					key := fmt.Sprintf("%v", v)
+					if _, ok := seen[key]; ok {
+						continue
+					}
+					seen[key] = struct{}{}
+					counter[key]++
+				}
 			}
 			keys := mapKeys(counter)
 			vals := make([]Facet, 0, len(keys))
@@ -168,23 +333,88 @@ func (c *defaultConnection) Search(index string, query Query) (Result, error) {
 		}
 	}
 
+	for _, rf := range query.RangeFacets {
+		vals := make([]Facet, 0, len(rf.Ranges))
+		for _, r := range rf.Ranges {
+			count := int64(0)
+			for _, hit := range matched {
+				values, _ := resolvePath(hit.Payload, rf.Field)
+				if matchAny(values, func(v Any) bool { return inFacetRange(v, r) }) {
+					count++
+				}
+			}
+			vals = append(vals, Facet{Field: rf.Field, Value: facetRangeKey(r), Count: count})
+		}
+		facets[rf.Field] = vals
+	}
+
 	total := int64(len(matched))
 	offset := query.Offset
 	if offset < 0 {
 		offset = 0
 	}
-	limit := query.Limit
-	if limit <= 0 {
-		limit = 20
+	if query.Cursor != "" {
+		if len(cursor.Values) != len(sorts) {
+			return Result{}, fmt.Errorf("search cursor does not match the query sorts")
+		}
+		offset = sort.Search(len(matched), func(i int) bool {
+			return compareSortKeys(sorts, keys[matched[i].ID], matched[i].ID, cursor.Values, cursor.ID) > 0
+		})
 	}
 	if offset > len(matched) {
 		offset = len(matched)
 	}
-	end := offset + limit
-	if end > len(matched) {
-		end = len(matched)
+	rest := matched[offset:]
+
+	res := Result{Total: total, Facets: facets}
+	if query.Scroll > 0 {
+		var err error
+		if res.Hits, res.Cursor, err = c.keepScroll(index, query, rest, total); err != nil {
+			return Result{}, err
+		}
+	} else {
+		res.Hits = pageHits(rest, query.Limit)
+		if len(res.Hits) < len(rest) {
+			last := res.Hits[len(res.Hits)-1]
+			res.Cursor = EncodeCursor(Cursor{Values: keys[last.ID], ID: last.ID})
+		}
+	}
+	idx.present(res.Hits, query)
+	res.Took = time.Since(start).Milliseconds()
+	return res, nil
+}
+
+// searchTerms splits the phrases off the keyword and adds the required
+// terms to it, keyword terms are all required already.
+func searchTerms(query Query) (string, []Phrase) {
+	keyword, phrases := SplitPhrases(query.Keyword)
+	phrases = append(phrases, query.Phrases...)
+	keyword = strings.TrimSpace(strings.Join(append([]string{keyword}, query.Required...), " "))
+	return keyword, phrases
+}
+
+// pageHits copies up to limit hits with their payloads, so that only a
+// page is ever copied out of the index.
+func pageHits(hits []Hit, limit int) []Hit {
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > len(hits) {
+		limit = len(hits)
+	}
+	page := make([]Hit, limit)
+	for i, hit := range hits[:limit] {
+		hit.Payload = cloneMap(hit.Payload)
+		page[i] = hit
+	}
+	return page
+}
+
+// present drops unstored fields, selects fields and highlights a page.
+func (idx *memoryIndex) present(hits []Hit, query Query) {
+	for i := range hits {
+		hits[i].Payload = idx.dropUnstored(hits[i].Payload)
 	}
-	hits := matched[offset:end]
 
 	if len(query.Fields) > 0 {
 		for i := range hits {
@@ -192,58 +422,94 @@ func (c *defaultConnection) Search(index string, query Query) (Result, error) {
 		}
 	}
 
-	if keyword != "" && len(query.Highlight) > 0 {
-		for i := range hits {
-			for _, field := range query.Highlight {
-				if raw, ok := hits[i].Payload[field]; ok {
-					text := fmt.Sprintf("%v", raw)
-					lower := strings.ToLower(text)
-					if pos := strings.Index(lower, keyword); pos >= 0 {
-						endPos := pos + len(keyword)
-						hits[i].Payload[field] = text[:pos] + "<em>" + text[pos:endPos] + "</em>" + text[endPos:]
+	keyword, phrases := searchTerms(query)
+
+	// phrase and optional words come first so that the keyword keeps its
+	// last term for prefix highlighting.
+	marked := keyword
+	for _, phrase := range phrases {
+		marked = phrase.Text + " " + marked
+	}
+	for _, group := range query.Should {
+		for _, one := range group {
+			words, quoted := SplitPhrases(one)
+			for _, phrase := range quoted {
+				words += " " + phrase.Text
+			}
+			marked = words + " " + marked
+		}
+	}
+	if marked = strings.TrimSpace(marked); marked != "" && len(query.Highlight) > 0 {
+		for _, field := range query.Highlight {
+			analyzer := idx.fieldAnalyzer(field)
+			terms := analyzer.Terms(marked)
+			if len(terms) == 0 && analyzer.hasStopWords() {
+				analyzer = analyzer.withoutStopWords()
+				terms = analyzer.Terms(marked)
+			}
+			if len(terms) == 0 {
+				continue
+			}
+			variants := idx.fuzzyVariants(field, terms, query.Prefix, query.Fuzzy)
+			variants = append(variants, idx.synonymVariants(analyzer, terms)...)
+			for i := range hits {
+				hits[i].Payload, _ = rewritePath(hits[i].Payload, field, func(raw Any) (Any, bool) {
+					switch raw.(type) {
+					case nil, Map:
+						return raw, false
 					}
-				}
+					return highlightText(analyzer, fmt.Sprintf("%v", raw), terms, variants, query.Prefix)
+				})
 			}
 		}
 	}
+}
 
-	return Result{Total: total, Took: time.Since(start).Milliseconds(), Hits: hits, Facets: facets}, nil
+func (c *defaultConnection) Suggest(index string, query SuggestQuery) ([]Suggestion, error) {
+	c.mutex.RLock()
+	idx := c.indexes[index]
+	c.mutex.RUnlock()
+	if idx == nil {
+		return []Suggestion{}, nil
+	}
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+	return idx.suggestions(query), nil
 }
 
 func (c *defaultConnection) Count(index string, query Query) (int64, error) {
+	return c.CountContext(context.Background(), index, query)
+}
+
+func (c *defaultConnection) CountContext(ctx context.Context, index string, query Query) (int64, error) {
 	query.Offset = 0
 	query.Limit = 1
-	res, err := c.Search(index, query)
+	query.Cursor, query.Scroll = "", 0
+	res, err := c.SearchContext(ctx, index, query)
 	if err != nil {
 		return 0, err
 	}
 	return res.Total, nil
 }
 
-func defaultKeywordMatch(keyword string, payload Map, prefix bool) bool {
-	if keyword == "" {
-		return true
-	}
-	bts, _ := json.Marshal(payload)
-	data := strings.ToLower(string(bts))
-	if prefix {
-		return strings.HasPrefix(data, keyword)
+// compareSortKeys orders two hits by their sort values, then by ID.
+func compareSortKeys(sorts []Sort, a []Any, aID string, b []Any, bID string) int {
+	for n, s := range sorts {
+		cmp := compareForSort(a[n], b[n])
+		if cmp == 0 {
+			continue
+		}
+		if s.Desc {
+			return -cmp
+		}
+		return cmp
 	}
-	return strings.Contains(data, keyword)
+	return strings.Compare(aID, bID)
 }
 
 func compareForSort(a, b Any) int {
-	if fa, oka := toFloat(a); oka {
-		if fb, okb := toFloat(b); okb {
-			switch {
-			case fa < fb:
-				return -1
-			case fa > fb:
-				return 1
-			default:
-				return 0
-			}
-		}
+	if cmp, ok := compareOrdered(a, b); ok {
+		return cmp
 	}
 	sa := fmt.Sprintf("%v", a)
 	sb := fmt.Sprintf("%v", b)
@@ -257,14 +523,147 @@ func compareForSort(a, b Any) int {
 	}
 }
 
+// checkQuery rejects filters, sorts and facets on declared fields that
+// are not flagged for it, undeclared fields are not restricted. Text
+// filters search a field, they need it searchable rather than filterable.
+func (idx *memoryIndex) checkQuery(query Query) error {
+	check := func(name, usage string, allowed func(Field) bool) error {
+		if field, ok := idx.schema[name]; ok && !allowed(field) {
+			return fmt.Errorf("search index %s field %s is not %s", idx.name, name, usage)
+		}
+		return nil
+	}
+	var err error
+	walkFilters(query.Filters, func(f Filter) {
+		switch {
+		case err != nil || f.Field == "":
+		case normalizeFilterOp(f.Op) == FilterText:
+			err = check(f.Field, "searchable", func(f Field) bool { return f.Searchable })
+		default:
+			err = check(f.Field, "filterable", func(f Field) bool { return f.Filterable })
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, s := range query.Sorts {
+		if err := check(s.Field, "sortable", func(f Field) bool { return f.Sortable }); err != nil {
+			return err
+		}
+	}
+	for _, name := range query.Facets {
+		if err := check(name, "facetable", func(f Field) bool { return f.Facetable }); err != nil {
+			return err
+		}
+	}
+	for _, rf := range query.RangeFacets {
+		if err := check(rf.Field, "facetable", func(f Field) bool { return f.Facetable }); err != nil {
+			return err
+		}
+	}
+	for _, fb := range query.SearchFields {
+		if err := check(fb.Field, "searchable", func(f Field) bool { return f.Searchable }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropUnstored removes the declared fields that are not stored.
+func (idx *memoryIndex) dropUnstored(payload Map) Map {
+	for name, field := range idx.schema {
+		if !field.Stored && name != "id" && name != idx.primary {
+			payload = removePath(payload, name)
+		}
+	}
+	return payload
+}
+
+// inFacetRange reports whether v is in [From, To).
+func inFacetRange(v Any, r FacetRange) bool {
+	if v == nil {
+		return false
+	}
+	if r.From != nil {
+		if cmp, ok := compareOrdered(v, r.From); !ok || cmp < 0 {
+			return false
+		}
+	}
+	if r.To != nil {
+		if cmp, ok := compareOrdered(v, r.To); !ok || cmp >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func facetRangeKey(r FacetRange) string {
+	if r.Key != "" {
+		return r.Key
+	}
+	from, to := "*", "*"
+	if r.From != nil {
+		from = fmt.Sprintf("%v", r.From)
+	}
+	if r.To != nil {
+		to = fmt.Sprintf("%v", r.To)
+	}
+	return from + "~" + to
+}
+
+// highlightText wraps every token of text that matches a query term with
+// <em></em>, overlapping and adjacent matches are merged into one span.
+// variants are the dictionary terms matched fuzzily.
+func highlightText(analyzer Analyzer, text string, terms, variants []string, prefix bool) (string, bool) {
+	set := make(map[string]struct{}, len(terms)+len(variants))
+	for _, term := range terms {
+		set[term] = struct{}{}
+	}
+	for _, term := range variants {
+		set[term] = struct{}{}
+	}
+	last := terms[len(terms)-1]
+
+	text = analyzer.filter(text)
+	spans := make([][2]int, 0)
+	for _, token := range analyzer.tokenize(text) {
+		_, ok := set[token.Term]
+		if !ok && !(prefix && strings.HasPrefix(token.Term, last)) {
+			continue
+		}
+		if n := len(spans); n > 0 && token.Start <= spans[n-1][1] {
+			if token.End > spans[n-1][1] {
+				spans[n-1][1] = token.End
+			}
+			continue
+		}
+		spans = append(spans, [2]int{token.Start, token.End})
+	}
+	if len(spans) == 0 {
+		return text, false
+	}
+
+	var sb strings.Builder
+	cursor := 0
+	for _, span := range spans {
+		sb.WriteString(text[cursor:span[0]])
+		sb.WriteString("<em>")
+		sb.WriteString(text[span[0]:span[1]])
+		sb.WriteString("</em>")
+		cursor = span[1]
+	}
+	sb.WriteString(text[cursor:])
+	return sb.String(), true
+}
+
 func pickFields(payload Map, fields []string) Map {
 	if payload == nil {
 		return Map{}
 	}
 	out := Map{}
 	for _, field := range fields {
-		if v, ok := payload[field]; ok {
-			out[field] = v
+		if picked, ok := pickPath(payload, field); ok {
+			out = mergePicked(out, picked).(Map)
 		}
 	}
 	if len(out) == 0 {
@@ -0,0 +1,144 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxFuzzyDistance caps the edit distance, larger ones match almost anything.
+const maxFuzzyDistance = 2
+
+// fuzzyEdits returns the edit distance allowed for a query term.
+func fuzzyEdits(fuzzy Fuzzy, term string) int {
+	distance := fuzzy.Distance
+	if distance == FuzzyAuto {
+		switch n := utf8.RuneCountInString(term); {
+		case n <= 2:
+			distance = 0
+		case n <= 5:
+			distance = 1
+		default:
+			distance = 2
+		}
+	}
+	if distance < 0 {
+		return 0
+	}
+	return min(distance, maxFuzzyDistance)
+}
+
+// fuzzyPenalty scales the score of a term found at some edit distance, so
+// that fuzzy hits always rank below exact ones.
+func fuzzyPenalty(distance int) float64 {
+	return 1 / float64(1+distance)
+}
+
+// fuzzyTerms walks the sorted lexicon like a Levenshtein automaton and
+// returns the terms within distance of term (transpositions count as one
+// edit) together with their distance. The dynamic programming rows of a
+// term are reused by the next one for their common prefix, and when no
+// extension of a prefix can match, every term sharing it is skipped. With
+// prefix set a term matches when one of its prefixes is within distance.
+func fuzzyTerms(lexicon []string, term string, distance, prefixLength int, prefix bool) map[string]int {
+	out := map[string]int{}
+	q := []rune(term)
+	n := len(q)
+	head := string(q[:min(max(prefixLength, 0), n)])
+
+	first := make([]int, n+1)
+	for j := range first {
+		first[j] = j
+	}
+	rows := [][]int{first}
+	var prev []rune
+
+	for k := sort.SearchStrings(lexicon, head); k < len(lexicon); {
+		word := lexicon[k]
+		if !strings.HasPrefix(word, head) {
+			break
+		}
+		c := []rune(word)
+		shared := 0
+		for shared < len(prev) && shared < len(c) && prev[shared] == c[shared] {
+			shared++
+		}
+		rows = rows[:min(shared, len(rows)-1)+1]
+		prev = c
+
+		best := rows[len(rows)-1][n]
+		if prefix {
+			for _, row := range rows {
+				best = min(best, row[n])
+			}
+		}
+		pruned := 0
+		for i := len(rows); i <= len(c) && !(prefix && best <= distance); i++ {
+			row := make([]int, n+1)
+			row[0] = i
+			lowest := i
+			for j := 1; j <= n; j++ {
+				cost := 1
+				if c[i-1] == q[j-1] {
+					cost = 0
+				}
+				v := min(rows[i-1][j]+1, row[j-1]+1, rows[i-1][j-1]+cost)
+				if i > 1 && j > 1 && c[i-1] == q[j-2] && c[i-2] == q[j-1] {
+					v = min(v, rows[i-2][j-2]+1)
+				}
+				row[j] = v
+				lowest = min(lowest, v)
+			}
+			rows = append(rows, row)
+			if prefix {
+				best = min(best, row[n])
+			} else {
+				best = row[n]
+			}
+			if lowest > distance {
+				pruned = i
+				break
+			}
+		}
+
+		if pruned > 0 {
+			stem := string(c[:pruned])
+			for k++; k < len(lexicon) && strings.HasPrefix(lexicon[k], stem); k++ {
+			}
+			continue
+		}
+		if best <= distance {
+			out[word] = best
+		}
+		k++
+	}
+	return out
+}
+
+// fuzzyVariants returns the dictionary terms of a field (and its nested
+// fields) that the query terms match fuzzily, for highlighting.
+func (idx *memoryIndex) fuzzyVariants(field string, terms []string, prefix bool, fuzzy Fuzzy) []string {
+	if fuzzy.Distance == 0 {
+		return nil
+	}
+	if declared, ok := idx.schema.Lookup(field); ok {
+		field = declared.Name
+	}
+	within := []FieldBoost{{Field: field}}
+	out := make([]string, 0)
+	for name, fi := range idx.fields {
+		if _, ok := fieldWeight(name, within); !ok {
+			continue
+		}
+		for i, term := range terms {
+			edits := fuzzyEdits(fuzzy, term)
+			if edits == 0 {
+				continue
+			}
+			for one := range fuzzyTerms(fi.lexicon, term, edits, fuzzy.PrefixLength, prefix && i == len(terms)-1) {
+				out = append(out, one)
+			}
+		}
+	}
+	return out
+}
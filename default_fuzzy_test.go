@@ -0,0 +1,98 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/infrago/base"
+)
+
+func TestFuzzyEdits(t *testing.T) {
+	cases := []struct {
+		fuzzy Fuzzy
+		term  string
+		edits int
+	}{
+		{Fuzzy{Distance: FuzzyAuto}, "go", 0},
+		{Fuzzy{Distance: FuzzyAuto}, "rust", 1},
+		{Fuzzy{Distance: FuzzyAuto}, "golang", 2},
+		{Fuzzy{Distance: FuzzyAuto}, "搜索引擎", 1},
+		{Fuzzy{Distance: 5}, "golang", maxFuzzyDistance},
+		{Fuzzy{Distance: 1}, "go", 1},
+	}
+	for _, one := range cases {
+		if got := fuzzyEdits(one.fuzzy, one.term); got != one.edits {
+			t.Errorf("fuzzyEdits(%+v, %q) = %d, want %d", one.fuzzy, one.term, got, one.edits)
+		}
+	}
+}
+
+func TestFuzzyTerms(t *testing.T) {
+	lexicon := []string{"sea", "search", "searcher", "season", "serach", "zebra"}
+	cases := []struct {
+		term     string
+		distance int
+		prefix   bool
+		want     map[string]int
+	}{
+		// a transposition is one edit
+		{"serach", 1, false, map[string]int{"serach": 0, "search": 1}},
+		{"sercher", 1, false, map[string]int{"searcher": 1}},
+		{"serc", 1, true, map[string]int{"search": 1, "searcher": 1, "serach": 1}},
+		{"zebar", 2, false, map[string]int{"zebra": 1}},
+	}
+	for _, one := range cases {
+		got := fuzzyTerms(lexicon, one.term, one.distance, 0, one.prefix)
+		if fmt.Sprint(got) != fmt.Sprint(one.want) {
+			t.Errorf("fuzzyTerms(%q, %d, %v) = %v, want %v", one.term, one.distance, one.prefix, got, one.want)
+		}
+	}
+	if got := fuzzyTerms(lexicon, "earch", 1, 1, false); len(got) != 0 {
+		t.Errorf("prefix length ignored: %v", got)
+	}
+}
+
+func TestFuzzySearch(t *testing.T) {
+	c := newConn(t)
+	c.Upsert("f", []Map{
+		{"id": "1", "title": "Full text search engine"},
+		{"id": "2", "title": "Serach typo"},
+		{"id": "3", "title": "Nothing here"},
+	})
+	res, err := c.Search("f", BuildQuery("serach", Map{"$fuzzy": true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// exact matches rank above fuzzy ones
+	if len(res.Hits) != 2 || res.Hits[0].ID != "2" || res.Hits[1].ID != "1" {
+		t.Fatalf("fuzzy matched %v", res.Hits)
+	}
+	if res, _ := c.Search("f", BuildQuery("serach")); res.Total != 1 {
+		t.Fatalf("exact search matched %d, want 1", res.Total)
+	}
+	if res, _ := c.Search("f", BuildQuery("earch", Map{"$fuzzy": Map{"distance": 1, "prefix": 1}})); res.Total != 0 {
+		t.Fatalf("prefix length ignored, matched %v", res.Hits)
+	}
+}
+
+func TestFuzzyRareVariant(t *testing.T) {
+	c := newConn(t)
+	c.Upsert("f", []Map{
+		{"id": "1", "title": "serach"},
+		{"id": "2", "title": "search"},
+		{"id": "3", "title": "search"},
+		{"id": "4", "title": "search"},
+		{"id": "5", "title": "search for the words in a rather long title about many other things"},
+	})
+	res, err := c.Search("f", BuildQuery("search", Map{"$fuzzy": true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the typo is rarer than the word, it still ranks last
+	if len(res.Hits) != 5 || res.Hits[4].ID != "1" {
+		t.Fatalf("fuzzy ranked %v", res.Hits)
+	}
+	if res.Hits[4].Score >= res.Hits[3].Score {
+		t.Fatalf("fuzzy hit scored %g, lowest exact one %g", res.Hits[4].Score, res.Hits[3].Score)
+	}
+}
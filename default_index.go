@@ -0,0 +1,631 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	. "github.com/infrago/base"
+)
+
+// BM25 tuning parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// positionGap separates the values of a multi valued field, so that phrases
+// do not match across them.
+const positionGap = 100
+
+// memoryIndex keeps the documents of one index together with one inverted
+// index per searchable field, all of them maintained on every write. Its
+// name is the logical one, without Config.Prefix, for errors.
+type memoryIndex struct {
+	mutex sync.RWMutex
+
+	name     string
+	primary  string
+	schema   Fields
+	analyzer Analyzer
+
+	// analyzers holds the resolved analyzer of every declared field.
+	analyzers map[string]Analyzer
+
+	// synonymTables holds the compiled synonyms per analyzer name, they
+	// are expanded at query time so updates need no re-indexing.
+	synonyms      []Synonym
+	synonymTables map[string]*synonymTable
+
+	docs      map[string]Map
+	fields    map[string]*fieldIndex
+	docFields map[string]map[string]*fieldTerms
+
+	// suggest is the completion trie of all suggestable fields, counting
+	// every document once.
+	suggest *suggestTrie
+}
+
+// fieldTerms is what one document contributes to one field index.
+type fieldTerms struct {
+	terms     map[string]int
+	positions map[string][]int
+	// stops counts the stop words dropped by the analyzer, they are kept
+	// aside for queries made of stop words only.
+	stops map[string]int
+	// words are the lowercased surface forms of the tokens, used for
+	// suggestions since terms may be stemmed.
+	words map[string]struct{}
+}
+
+// fieldIndex is the inverted index (term -> doc id -> term frequency) of
+// one field, with the field lengths needed by BM25.
+type fieldIndex struct {
+	name     string
+	boost    float64
+	analyzer Analyzer
+	postings map[string]map[string]int
+	lengths  map[string]int
+	totalLen int
+
+	// stopPostings is the inverted index of the dropped stop words.
+	stopPostings map[string]map[string]int
+
+	// suggest is the completion trie, nil when the field is not suggestable.
+	suggest *suggestTrie
+
+	// lexicon is the sorted term dictionary used for prefix expansion,
+	// it is rebuilt lazily after writes.
+	lexicon []string
+	dirty   bool
+}
+
+func newMemoryIndex(name string, analyzer Analyzer) *memoryIndex {
+	idx := &memoryIndex{name: name, primary: "id", analyzer: analyzer}
+	idx.reset()
+	return idx
+}
+
+func (idx *memoryIndex) reset() {
+	idx.docs = map[string]Map{}
+	idx.fields = map[string]*fieldIndex{}
+	idx.docFields = map[string]map[string]*fieldTerms{}
+	idx.suggest = newSuggestTrie()
+}
+
+// configure applies an index definition and rebuilds the inverted index.
+func (idx *memoryIndex) configure(index Index) {
+	idx.analyzer = module.IndexAnalyzer(index)
+	idx.schema = index.Schema
+	idx.primary = index.Primary
+	if idx.primary == "" {
+		idx.primary = "id"
+	}
+	idx.analyzers = map[string]Analyzer{}
+	for name, field := range idx.schema {
+		analyzer := idx.analyzer
+		if field.Type == FieldKeyword {
+			analyzer, _ = module.Analyzer(AnalyzerKeyword)
+		}
+		if one, ok := module.Analyzer(field.Analyzer); ok {
+			analyzer = one.WithStopWords(index.StopWords...)
+		}
+		idx.analyzers[name] = analyzer
+	}
+	idx.synonyms = index.Synonyms
+	idx.compileSynonyms()
+
+	docs := idx.docs
+	idx.reset()
+	for id, payload := range docs {
+		idx.put(id, payload)
+	}
+}
+
+// fieldAnalyzer returns the analyzer used for a field.
+func (idx *memoryIndex) fieldAnalyzer(name string) Analyzer {
+	if field, ok := idx.schema.Lookup(name); ok {
+		if analyzer, ok := idx.analyzers[field.Name]; ok {
+			return analyzer
+		}
+	}
+	return idx.analyzer
+}
+
+func (idx *memoryIndex) put(id string, payload Map) {
+	idx.remove(id)
+
+	fields := map[string]*fieldTerms{}
+	offsets := map[string]int{}
+	idx.walk("", payload, func(field string, text string) {
+		ft, ok := fields[field]
+		if !ok {
+			ft = &fieldTerms{terms: map[string]int{}, positions: map[string][]int{}, stops: map[string]int{}, words: map[string]struct{}{}}
+			fields[field] = ft
+		}
+		analyzer := idx.fieldAnalyzer(field)
+		text = analyzer.filter(text)
+		base, next := offsets[field], 0
+		type slot struct{ position, start int }
+		kept := map[slot]struct{}{}
+		for _, token := range analyzer.tokenize(text) {
+			ft.terms[token.Term]++
+			ft.positions[token.Term] = append(ft.positions[token.Term], base+token.Position)
+			ft.words[strings.ToLower(text[token.Start:token.End])] = struct{}{}
+			next = max(next, token.Position+1)
+			kept[slot{token.Position, token.Start}] = struct{}{}
+		}
+		if analyzer.hasStopWords() {
+			for _, token := range analyzer.withoutStopWords().tokenize(text) {
+				if _, ok := kept[slot{token.Position, token.Start}]; ok {
+					continue
+				}
+				ft.stops[token.Term]++
+				ft.positions[token.Term] = append(ft.positions[token.Term], base+token.Position)
+				next = max(next, token.Position+1)
+			}
+		}
+		offsets[field] = base + next + positionGap
+	})
+
+	idx.docs[id] = payload
+	idx.docFields[id] = fields
+	for name, ft := range fields {
+		fi, ok := idx.fields[name]
+		if !ok {
+			fi = idx.newFieldIndex(name)
+			idx.fields[name] = fi
+		}
+		fi.add(id, ft)
+		if fi.suggest != nil {
+			for word := range ft.words {
+				idx.suggest.add(word, id)
+			}
+		}
+	}
+}
+
+func (idx *memoryIndex) newFieldIndex(name string) *fieldIndex {
+	boost := 1.0
+	suggest := len(idx.schema) == 0
+	if field, ok := idx.schema[name]; ok {
+		if field.Boost > 0 {
+			boost = field.Boost
+		}
+		suggest = field.Suggest
+	}
+	fi := &fieldIndex{
+		name:     name,
+		boost:    boost,
+		analyzer: idx.fieldAnalyzer(name),
+		postings: map[string]map[string]int{},
+		lengths:  map[string]int{},
+
+		stopPostings: map[string]map[string]int{},
+	}
+	if suggest {
+		fi.suggest = newSuggestTrie()
+	}
+	return fi
+}
+
+func (idx *memoryIndex) remove(id string) {
+	for name, ft := range idx.docFields[id] {
+		if fi, ok := idx.fields[name]; ok {
+			if fi.suggest != nil {
+				for word := range ft.words {
+					idx.suggest.remove(word, id)
+				}
+			}
+			fi.remove(id, ft)
+			if len(fi.lengths) == 0 {
+				delete(idx.fields, name)
+			}
+		}
+	}
+	delete(idx.docFields, id)
+	delete(idx.docs, id)
+}
+
+// walk calls fn for every searchable text value of a payload. Without a
+// schema every string leaf except the primary key is searchable and named
+// by its dotted path, with a schema only the declared searchable fields are.
+func (idx *memoryIndex) walk(path string, v Any, fn func(field string, text string)) {
+	switch vv := v.(type) {
+	case nil:
+	case Map:
+		for key, one := range vv {
+			next := key
+			if path != "" {
+				next = path + "." + key
+			}
+			idx.walk(next, one, fn)
+		}
+	case []Map:
+		for _, one := range vv {
+			idx.walk(path, one, fn)
+		}
+	case []Any:
+		for _, one := range vv {
+			idx.walk(path, one, fn)
+		}
+	case []string:
+		for _, one := range vv {
+			idx.walk(path, one, fn)
+		}
+	default:
+		if len(idx.schema) == 0 {
+			if text, ok := vv.(string); ok && path != "id" && path != idx.primary {
+				fn(path, text)
+			}
+			return
+		}
+		field, ok := idx.schema.Lookup(path)
+		if !ok || !field.Searchable {
+			return
+		}
+		if text, ok := vv.(string); ok {
+			fn(field.Name, text)
+		} else {
+			fn(field.Name, fmt.Sprintf("%v", vv))
+		}
+	}
+}
+
+// prepare rebuilds lazy structures so that readers can work under RLock.
+func (idx *memoryIndex) prepare() {
+	idx.mutex.RLock()
+	dirty := false
+	for _, fi := range idx.fields {
+		if fi.dirty || fi.lexicon == nil {
+			dirty = true
+			break
+		}
+	}
+	idx.mutex.RUnlock()
+	if !dirty {
+		return
+	}
+	idx.mutex.Lock()
+	for _, fi := range idx.fields {
+		fi.terms()
+	}
+	idx.mutex.Unlock()
+}
+
+// match scores all documents for a keyword. Fields sharing an analyzer form
+// a group, a document matches a group when every query term is found in at
+// least one field of it (cross field AND) and it matches the keyword when
+// it matches any group. Terms with synonyms match any of their expansions.
+// With prefix set the last term also matches the terms it starts, with
+// fuzzy set terms also match dictionary terms within the allowed edit
+// distance at a lower score. When within is set only the named fields
+// (and their nested fields) take part, with their boost multiplied by the
+// given one. An empty keyword matches all docs with a neutral score.
+func (idx *memoryIndex) match(keyword string, prefix bool, fuzzy Fuzzy, within []FieldBoost) map[string]float64 {
+	if strings.TrimSpace(keyword) == "" {
+		out := make(map[string]float64, len(idx.docs))
+		for id := range idx.docs {
+			out[id] = 1.0
+		}
+		return out
+	}
+
+	type group struct {
+		stops   bool
+		clauses [][][]string
+		fields  []*fieldIndex
+		weights []float64
+	}
+	groups := map[string]*group{}
+	order := make([]string, 0)
+	names := make([]string, 0, len(idx.fields))
+	for name := range idx.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fi := idx.fields[name]
+		weight, ok := fieldWeight(name, within)
+		if !ok {
+			continue
+		}
+		g, ok := groups[fi.analyzer.Name]
+		if !ok {
+			// a keyword made of stop words only is matched against the
+			// stop words put aside at index time
+			terms, stops := fi.analyzer.Terms(keyword), false
+			if len(terms) == 0 && fi.analyzer.hasStopWords() {
+				terms, stops = fi.analyzer.withoutStopWords().Terms(keyword), true
+			}
+			g = &group{stops: stops, clauses: idx.synonymTables[fi.analyzer.Name].expand(terms)}
+			groups[fi.analyzer.Name] = g
+			order = append(order, fi.analyzer.Name)
+		}
+		g.fields = append(g.fields, fi)
+		g.weights = append(g.weights, weight)
+	}
+
+	total := len(idx.docs)
+	out := map[string]float64{}
+	for _, key := range order {
+		g := groups[key]
+		var acc map[string]float64
+		for i, clause := range g.clauses {
+			// a clause matches through its best alternative, all terms of
+			// an alternative are required
+			list := map[string]float64{}
+			for a, alt := range clause {
+				var found map[string]float64
+				for t, term := range alt {
+					last := prefix && a == 0 && i == len(g.clauses)-1 && t == len(alt)-1
+					one := map[string]float64{}
+					for n, fi := range g.fields {
+						lookup := fi.lookup(term, last, fuzzy, total)
+						if g.stops {
+							lookup = fi.lookupStop(term, total)
+						}
+						for id, score := range lookup {
+							one[id] += score * g.weights[n]
+						}
+					}
+					found = intersectScores(found, one, t == 0)
+					if len(found) == 0 {
+						break
+					}
+				}
+				for id, score := range found {
+					list[id] = max(list[id], score)
+				}
+			}
+			acc = intersectScores(acc, list, i == 0)
+			if len(acc) == 0 {
+				break
+			}
+		}
+		for id, score := range acc {
+			out[id] += score
+		}
+	}
+	return out
+}
+
+// exclude removes the candidates matching any of the excluded terms or
+// quoted phrases.
+func (idx *memoryIndex) exclude(candidates map[string]float64, excluded []string, within []FieldBoost) {
+	for _, one := range excluded {
+		keyword, phrases := SplitPhrases(one)
+		var found map[string]float64
+		if keyword != "" {
+			found = idx.match(keyword, false, Fuzzy{}, within)
+		}
+		if len(phrases) > 0 {
+			found = idx.matchPhrases(phrases, within, found, keyword == "")
+		}
+		for id := range found {
+			delete(candidates, id)
+		}
+	}
+}
+
+// matchShould keeps the candidates matching an alternative of every
+// group and adds the scores of the alternatives they match. With replace
+// the candidates stand for a search without keyword and give way to the
+// first group.
+func (idx *memoryIndex) matchShould(candidates map[string]float64, groups [][]string, prefix bool, fuzzy Fuzzy, within []FieldBoost, replace bool) map[string]float64 {
+	for _, group := range groups {
+		found := map[string]float64{}
+		for _, one := range group {
+			keyword, phrases := SplitPhrases(one)
+			var list map[string]float64
+			if keyword != "" {
+				list = idx.match(keyword, prefix, fuzzy, within)
+			}
+			if len(phrases) > 0 {
+				list = idx.matchPhrases(phrases, within, list, keyword == "")
+			}
+			for id, score := range list {
+				found[id] += score
+			}
+		}
+		candidates = intersectScores(candidates, found, replace)
+		replace = false
+	}
+	return candidates
+}
+
+// fieldWeight reports whether a field takes part in a restricted search and
+// with which weight.
+func fieldWeight(name string, within []FieldBoost) (float64, bool) {
+	if len(within) == 0 {
+		return 1, true
+	}
+	for _, fb := range within {
+		if name == fb.Field || strings.HasPrefix(name, fb.Field+".") {
+			if fb.Boost <= 0 {
+				return 1, true
+			}
+			return fb.Boost, true
+		}
+	}
+	return 0, false
+}
+
+// intersectScores keeps the ids present in both maps and sums their scores.
+func intersectScores(acc, list map[string]float64, first bool) map[string]float64 {
+	if first {
+		return list
+	}
+	if len(list) < len(acc) {
+		acc, list = list, acc
+	}
+	out := make(map[string]float64, len(acc))
+	for id, score := range acc {
+		if other, ok := list[id]; ok {
+			out[id] = score + other
+		}
+	}
+	return out
+}
+
+func (fi *fieldIndex) add(id string, ft *fieldTerms) {
+	length := 0
+	for term, freq := range ft.terms {
+		length += freq
+		list, ok := fi.postings[term]
+		if !ok {
+			list = map[string]int{}
+			fi.postings[term] = list
+			fi.dirty = true
+		}
+		list[id] = freq
+	}
+	fi.lengths[id] = length
+	fi.totalLen += length
+	for term, freq := range ft.stops {
+		list, ok := fi.stopPostings[term]
+		if !ok {
+			list = map[string]int{}
+			fi.stopPostings[term] = list
+		}
+		list[id] = freq
+	}
+	if fi.suggest != nil {
+		for word := range ft.words {
+			fi.suggest.add(word, id)
+		}
+	}
+}
+
+func (fi *fieldIndex) remove(id string, ft *fieldTerms) {
+	if fi.suggest != nil {
+		for word := range ft.words {
+			fi.suggest.remove(word, id)
+		}
+	}
+	for term := range ft.terms {
+		list := fi.postings[term]
+		delete(list, id)
+		if len(list) == 0 {
+			delete(fi.postings, term)
+			fi.dirty = true
+		}
+	}
+	for term := range ft.stops {
+		list := fi.stopPostings[term]
+		delete(list, id)
+		if len(list) == 0 {
+			delete(fi.stopPostings, term)
+		}
+	}
+	fi.totalLen -= fi.lengths[id]
+	delete(fi.lengths, id)
+}
+
+// terms returns the sorted term dictionary, callers must hold the write lock
+// or make sure the lexicon is not dirty.
+func (fi *fieldIndex) terms() []string {
+	if fi.dirty || fi.lexicon == nil {
+		lexicon := make([]string, 0, len(fi.postings))
+		for term := range fi.postings {
+			lexicon = append(lexicon, term)
+		}
+		sort.Strings(lexicon)
+		fi.lexicon = lexicon
+		fi.dirty = false
+	}
+	return fi.lexicon
+}
+
+// expand returns all dictionary terms that start with prefix.
+func (fi *fieldIndex) expand(prefix string) []string {
+	lexicon := fi.lexicon
+	start := sort.SearchStrings(lexicon, prefix)
+	out := make([]string, 0)
+	for i := start; i < len(lexicon); i++ {
+		if !strings.HasPrefix(lexicon[i], prefix) {
+			break
+		}
+		out = append(out, lexicon[i])
+	}
+	return out
+}
+
+// lookup returns the boosted BM25 contribution of a query term per
+// document, expanding it as a prefix when required. Documents only found
+// through fuzzy variants get the penalized score of their best variant.
+func (fi *fieldIndex) lookup(term string, prefix bool, fuzzy Fuzzy, total int) map[string]float64 {
+	terms := []string{term}
+	if prefix {
+		terms = fi.expand(term)
+	}
+	out := map[string]float64{}
+	for _, one := range terms {
+		list := fi.postings[one]
+		for id, freq := range list {
+			out[id] += fi.boost * fi.bm25(freq, fi.lengths[id], len(list), total)
+		}
+	}
+	edits := fuzzyEdits(fuzzy, term)
+	if edits == 0 {
+		return out
+	}
+	// variants take the document frequency of the term itself, a rare
+	// typo must not weigh more than the word it stands for, and stay below
+	// the lowest exact score.
+	docFreq := len(fi.postings[term])
+	floor := math.Inf(1)
+	for _, score := range out {
+		floor = min(floor, score)
+	}
+	best := map[string]float64{}
+	for one, distance := range fuzzyTerms(fi.lexicon, term, edits, fuzzy.PrefixLength, prefix) {
+		if distance == 0 {
+			continue
+		}
+		list := fi.postings[one]
+		df := docFreq
+		if df == 0 {
+			df = len(list)
+		}
+		for id, freq := range list {
+			if _, ok := out[id]; ok {
+				continue
+			}
+			penalty := fuzzyPenalty(distance)
+			score := min(penalty*fi.boost*fi.bm25(freq, fi.lengths[id], df, total), penalty*floor)
+			best[id] = max(best[id], score)
+		}
+	}
+	for id, score := range best {
+		out[id] = score
+	}
+	return out
+}
+
+// lookupStop is lookup for a stop word.
+func (fi *fieldIndex) lookupStop(term string, total int) map[string]float64 {
+	out := map[string]float64{}
+	list := fi.stopPostings[term]
+	for id, freq := range list {
+		out[id] = fi.boost * fi.bm25(freq, fi.lengths[id], len(list), total)
+	}
+	return out
+}
+
+// bm25 scores one term of one document.
+func (fi *fieldIndex) bm25(freq, length, docFreq, total int) float64 {
+	if total == 0 || freq == 0 || len(fi.lengths) == 0 {
+		return 0
+	}
+	avg := float64(fi.totalLen) / float64(len(fi.lengths))
+	if avg <= 0 {
+		avg = 1
+	}
+	n := float64(total)
+	idf := math.Log(1 + (n-float64(docFreq)+0.5)/(float64(docFreq)+0.5))
+	tf := float64(freq)
+	return idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(length)/avg))
+}
@@ -0,0 +1,173 @@
+package search
+
+import (
+	"testing"
+
+	. "github.com/infrago/base"
+)
+
+func TestIndexWrites(t *testing.T) {
+	c := newConn(t)
+	c.SyncIndex("a", Index{})
+	c.Upsert("a", []Map{
+		{"id": "1", "title": "Hello World"},
+		{"id": "2", "title": "hello golang"},
+		{"id": "3", "title": "other"},
+	})
+	total := func(keyword string) int64 {
+		t.Helper()
+		res, err := c.Search("a", BuildQuery(keyword))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Total
+	}
+	if n := total("hello"); n != 2 {
+		t.Fatalf("hello matched %d, want 2", n)
+	}
+
+	// replacing a document drops its old terms
+	c.Upsert("a", []Map{{"id": "1", "title": "bye"}})
+	if n := total("world"); n != 0 {
+		t.Fatalf("world matched %d after its document changed", n)
+	}
+	if n := total("hello"); n != 1 {
+		t.Fatalf("hello matched %d after a document changed, want 1", n)
+	}
+
+	c.Delete("a", []string{"2"})
+	if n := total("golang"); n != 0 {
+		t.Fatalf("golang matched %d after its document was deleted", n)
+	}
+	if n := total(""); n != 2 {
+		t.Fatalf("%d documents left, want 2", n)
+	}
+
+	c.Clear("a")
+	if n := total(""); n != 0 {
+		t.Fatalf("cleared index holds %d documents", n)
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	c := newConn(t)
+	c.Upsert("a", []Map{
+		{"id": "1", "title": "Hello World"},
+		{"id": "2", "title": "hello golang"},
+		{"id": "3", "title": "other"},
+	})
+	cases := []struct {
+		keyword string
+		prefix  bool
+		total   int64
+	}{
+		{"hello", false, 2},
+		{"HELLO world", false, 1},
+		{"hello go", false, 0},
+		{"hello go", true, 1},
+		{"missing", false, 0},
+		{"", false, 3},
+	}
+	for _, one := range cases {
+		res, err := c.Search("a", BuildQuery(one.keyword, Map{"$prefix": one.prefix}))
+		if err != nil || res.Total != one.total {
+			t.Errorf("search %q prefix %v matched %d %v, want %d", one.keyword, one.prefix, res.Total, err, one.total)
+		}
+	}
+}
+
+func hitIDs(hits []Hit) string {
+	ids := ""
+	for _, hit := range hits {
+		ids += hit.ID
+	}
+	return ids
+}
+
+func TestRanking(t *testing.T) {
+	c := newConn(t)
+	c.Upsert("a", []Map{
+		{"id": "1", "title": "go go go language"},
+		{"id": "2", "title": "go is a language with a long description text here"},
+		{"id": "3", "title": "go language"},
+		{"id": "4", "title": "rust language"},
+		{"id": "5", "title": "rust"},
+	})
+	cases := []struct {
+		keyword string
+		args    Map
+		ids     string
+	}{
+		// term frequency, then shorter fields
+		{"go", nil, "132"},
+		// equal scores fall back to the document id
+		{"language", nil, "3412"},
+		{"go", Map{"$sort": "_score"}, "231"},
+	}
+	for _, one := range cases {
+		res, err := c.Search("a", BuildQuery(one.keyword, one.args))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hitIDs(res.Hits); got != one.ids {
+			t.Errorf("search %q %v ranked %s, want %s", one.keyword, one.args, got, one.ids)
+		}
+	}
+
+	res, _ := c.Search("a", BuildQuery("go"))
+	for i := 1; i < len(res.Hits); i++ {
+		if res.Hits[i-1].Score <= res.Hits[i].Score {
+			t.Fatalf("scores are not decreasing: %v", res.Hits)
+		}
+	}
+
+	// rare terms weigh more than common ones
+	rare, _ := c.Search("a", BuildQuery("rust"))
+	common, _ := c.Search("a", BuildQuery("language"))
+	var rareScore, commonScore float64
+	for _, hit := range rare.Hits {
+		if hit.ID == "4" {
+			rareScore = hit.Score
+		}
+	}
+	for _, hit := range common.Hits {
+		if hit.ID == "4" {
+			commonScore = hit.Score
+		}
+	}
+	if rareScore <= commonScore {
+		t.Fatalf("rare term scored %g, common one %g", rareScore, commonScore)
+	}
+}
+
+func TestWithinFields(t *testing.T) {
+	c := newConn(t)
+	c.Upsert("w", []Map{
+		{"id": "1", "title": "golang", "body": "rust"},
+		{"id": "2", "title": "rust", "body": "golang"},
+		{"id": "3", "author": Map{"name": "golang"}},
+	})
+	cases := []struct {
+		keyword string
+		args    Map
+		ids     string
+	}{
+		// nested fields are searched under their parent
+		{"golang", Map{"$within": "title^3, author"}, "13"},
+		{"golang", Map{"$within": "title, author^3"}, "31"},
+		{"golang", Map{"$within": "author.name"}, "3"},
+		{"golang", Map{"$within": "missing"}, ""},
+		{"golang", Map{"$boost": Map{"body": 5, "title": 1}}, "21"},
+		{"golang", Map{"$boost": Map{"body": 1, "title": 5}}, "12"},
+		{"", Map{"$within": "title"}, "123"},
+	}
+	for _, one := range cases {
+		res, err := c.Search("w", BuildQuery(one.keyword, one.args))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hitIDs(res.Hits); got != one.ids {
+			t.Errorf("search %q %v matched %s, want %s", one.keyword, one.args, got, one.ids)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package search
+
+import (
+	"slices"
+	"sort"
+)
+
+// matchPhrases keeps the candidates matching every phrase and adds the
+// phrase scores, when the keyword was empty the candidates are replaced.
+func (idx *memoryIndex) matchPhrases(phrases []Phrase, within []FieldBoost, candidates map[string]float64, replace bool) map[string]float64 {
+	acc := candidates
+	for i, phrase := range phrases {
+		acc = intersectScores(acc, idx.matchPhrase(phrase, within), replace && i == 0)
+		if len(acc) == 0 {
+			break
+		}
+	}
+	return acc
+}
+
+// matchPhrase scores the documents where one field holds the phrase, a
+// sloppy match scores lower the more its words are moved.
+func (idx *memoryIndex) matchPhrase(phrase Phrase, within []FieldBoost) map[string]float64 {
+	total := len(idx.docs)
+	out := map[string]float64{}
+	for name, fi := range idx.fields {
+		weight, ok := fieldWeight(name, within)
+		if !ok {
+			continue
+		}
+		postings := fi.postings
+		tokens := fi.analyzer.Analyze(phrase.Text)
+		if len(tokens) == 0 && fi.analyzer.hasStopWords() {
+			postings = fi.stopPostings
+			tokens = fi.analyzer.withoutStopWords().Analyze(phrase.Text)
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+		rarest := postings[tokens[0].Term]
+		for _, token := range tokens[1:] {
+			if list := postings[token.Term]; len(list) < len(rarest) {
+				rarest = list
+			}
+		}
+	docs:
+		for id := range rarest {
+			lists := make([][]int, len(tokens))
+			score := 0.0
+			for n, token := range tokens {
+				list := postings[token.Term]
+				freq, ok := list[id]
+				if !ok {
+					continue docs
+				}
+				lists[n] = idx.docFields[id][name].positions[token.Term]
+				score += fi.bm25(freq, fi.lengths[id], len(list), total)
+			}
+			span, ok := phraseSpan(tokens, lists, phrase.Slop)
+			if !ok {
+				continue
+			}
+			out[id] += fi.boost * weight * score / float64(1+span)
+		}
+	}
+	return out
+}
+
+// phraseSpan finds the closest occurrence of the phrase words, each word
+// position is shifted by its position in the phrase so that an exact
+// match puts them all at the same value. The span is the distance between
+// the smallest and largest shifted position, it must not exceed slop. A
+// word repeated in the phrase takes a different position each time.
+//
+// For every smallest shifted position lo the words take, in phrase order,
+// the first free position at or after lo, which gives the closest
+// occurrence starting there.
+func phraseSpan(tokens []Token, lists [][]int, slop int) (int, bool) {
+	sorted := make([][]int, len(lists))
+	starts := make([]int, 0)
+	for n, list := range lists {
+		one := append([]int(nil), list...)
+		sort.Ints(one)
+		sorted[n] = one
+		for _, pos := range one {
+			starts = append(starts, pos-tokens[n].Position)
+		}
+	}
+	sort.Ints(starts)
+	order := make([]int, len(tokens))
+	for n := range order {
+		order[n] = n
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return tokens[order[i]].Position < tokens[order[j]].Position
+	})
+
+	best := -1
+	for i, lo := range starts {
+		if i > 0 && lo == starts[i-1] {
+			continue
+		}
+		hi := lo
+		taken := map[string][]int{}
+		for _, n := range order {
+			token, list := tokens[n], sorted[n]
+			k := sort.SearchInts(list, lo+token.Position)
+			for k < len(list) && slices.Contains(taken[token.Term], list[k]) {
+				k++
+			}
+			if k == len(list) {
+				// no occurrence starts at lo or later
+				return best, best >= 0 && best <= slop
+			}
+			taken[token.Term] = append(taken[token.Term], list[k])
+			hi = max(hi, list[k]-token.Position)
+		}
+		if best < 0 || hi-lo < best {
+			best = hi - lo
+		}
+		if best == 0 {
+			break
+		}
+	}
+	return best, best >= 0 && best <= slop
+}
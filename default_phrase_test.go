@@ -0,0 +1,87 @@
+package search
+
+import (
+	"testing"
+
+	. "github.com/infrago/base"
+)
+
+func TestPhraseMatch(t *testing.T) {
+	c := newConn(t)
+	c.SyncIndex("p", Index{Language: "en"})
+	c.Upsert("p", []Map{
+		{"id": "1", "title": "machine learning in go"},
+		{"id": "2", "title": "learning machine code"},
+		{"id": "3", "title": "machine based deep learning"},
+		{"id": "4", "tags": []string{"machine", "learning"}},
+	})
+	cases := []struct {
+		query Query
+		ids   []string
+	}{
+		{BuildQuery(`"machine learning"`), []string{"1"}},
+		// closer matches rank first, array elements never form a phrase
+		{BuildQuery(`"machine learning"~2`), []string{"1", "2", "3"}},
+		{BuildQuery(`code`, Map{"$phrase": "learning machine"}), []string{"2"}},
+	}
+	for _, one := range cases {
+		res, err := c.Search("p", one.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Hits) != len(one.ids) || res.Hits[0].ID != one.ids[0] {
+			t.Errorf("%s matched %v, want %v", one.query.Keyword, res.Hits, one.ids)
+		}
+	}
+}
+
+func TestPhraseRepeatedWord(t *testing.T) {
+	c := newConn(t)
+	c.Upsert("p", []Map{
+		{"id": "1", "title": "go fast"},
+		{"id": "2", "title": "go go gadget"},
+		{"id": "3", "title": "go there go"},
+	})
+	cases := []struct {
+		keyword string
+		total   int64
+	}{
+		{`"go go"`, 1},
+		{`"go go"~1`, 2},
+		{`"go go"~5`, 2},
+		{`"go go go"~5`, 0},
+	}
+	for _, one := range cases {
+		res, _ := c.Search("p", BuildQuery(one.keyword))
+		if res.Total != one.total {
+			t.Errorf("%s matched %d, want %d", one.keyword, res.Total, one.total)
+		}
+	}
+}
+
+func TestPhraseSpan(t *testing.T) {
+	tokens := []Token{{Term: "a", Position: 0}, {Term: "b", Position: 1}}
+	cases := []struct {
+		lists [][]int
+		span  int
+	}{
+		{[][]int{{4}, {5}}, 0},
+		{[][]int{{4}, {3}}, 2},
+		{[][]int{{1, 9}, {3, 10}}, 0},
+		{[][]int{{1, 20}, {5, 30}}, 3},
+	}
+	for _, one := range cases {
+		if span, ok := phraseSpan(tokens, one.lists, 10); !ok || span != one.span {
+			t.Errorf("span of %v = %d, want %d", one.lists, span, one.span)
+		}
+	}
+
+	// the same position can not hold both words of "a a"
+	repeated := []Token{{Term: "a", Position: 0}, {Term: "a", Position: 1}}
+	if _, ok := phraseSpan(repeated, [][]int{{7}, {7}}, 3); ok {
+		t.Fatal("one occurrence matched a repeated word twice")
+	}
+	if span, ok := phraseSpan(repeated, [][]int{{2, 7}, {2, 7}}, 10); !ok || span != 4 {
+		t.Fatalf("span %d, want 4", span)
+	}
+}
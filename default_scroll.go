@@ -0,0 +1,111 @@
+package search
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// DefaultMaxScrolls caps the scrolls a default driver connection keeps at
+// once, the max_scrolls setting changes it.
+const DefaultMaxScrolls = 1000
+
+// scrollState is a sorted result set kept for a scroll, its hits are
+// presented page by page with the query that started it.
+type scrollState struct {
+	index   string
+	query   Query
+	hits    []Hit
+	total   int64
+	keep    time.Duration
+	expires time.Time
+}
+
+// keepScroll keeps hits for query.Scroll and returns the first page with
+// the cursor of the next one, nothing is kept when it all fits a page. It
+// fails when the connection already keeps as many scrolls as it may.
+func (c *defaultConnection) keepScroll(index string, query Query, hits []Hit, total int64) ([]Hit, string, error) {
+	page := pageHits(hits, query.Limit)
+	if len(page) == len(hits) {
+		return page, "", nil
+	}
+	now := time.Now()
+	query.Cursor = ""
+	state := &scrollState{
+		index: index, query: query, hits: hits, total: total,
+		keep: query.Scroll, expires: now.Add(query.Scroll),
+	}
+	id := newScrollID()
+
+	c.scrollMutex.Lock()
+	defer c.scrollMutex.Unlock()
+	c.purgeScrollsLocked(now)
+	if len(c.scrolls) >= c.maxScrolls {
+		return nil, "", fmt.Errorf("search connection keeps too many scrolls, at most %d", c.maxScrolls)
+	}
+	if c.scrolls == nil {
+		c.scrolls = make(map[string]*scrollState)
+	}
+	c.scrolls[id] = state
+	return page, EncodeCursor(Cursor{Scroll: id, Offset: len(page)}), nil
+}
+
+// scrollPage returns the page of a kept scroll at cursor, a Scroll set on
+// the query replaces the keep alive of the scroll. The scroll stays until
+// it expires so that the last page can be fetched again.
+func (c *defaultConnection) scrollPage(index string, query Query, cursor Cursor, start time.Time) (Result, error) {
+	now := time.Now()
+	c.scrollMutex.Lock()
+	c.purgeScrollsLocked(now)
+	state := c.scrolls[cursor.Scroll]
+	if state == nil || state.index != index {
+		c.scrollMutex.Unlock()
+		return Result{}, fmt.Errorf("search scroll %s expired or not found", cursor.Scroll)
+	}
+	if query.Scroll > 0 {
+		state.keep = query.Scroll
+	}
+	state.expires = now.Add(state.keep)
+	offset := min(max(cursor.Offset, 0), len(state.hits))
+	page := pageHits(state.hits[offset:], query.Limit)
+	res := Result{Total: state.total, Hits: page, Facets: map[string][]Facet{}}
+	if next := offset + len(page); next < len(state.hits) {
+		res.Cursor = EncodeCursor(Cursor{Scroll: cursor.Scroll, Offset: next})
+	}
+	kept := state.query
+	c.scrollMutex.Unlock()
+
+	c.mutex.RLock()
+	idx := c.indexes[index]
+	c.mutex.RUnlock()
+	if idx != nil {
+		idx.mutex.RLock()
+		idx.present(res.Hits, kept)
+		idx.mutex.RUnlock()
+	}
+	res.Took = time.Since(start).Milliseconds()
+	return res, nil
+}
+
+// purgeScrolls drops the expired scrolls, every search does so that
+// abandoned scrolls do not pile up between scroll calls.
+func (c *defaultConnection) purgeScrolls() {
+	c.scrollMutex.Lock()
+	c.purgeScrollsLocked(time.Now())
+	c.scrollMutex.Unlock()
+}
+
+func (c *defaultConnection) purgeScrollsLocked(now time.Time) {
+	for id, state := range c.scrolls {
+		if now.After(state.expires) {
+			delete(c.scrolls, id)
+		}
+	}
+}
+
+func newScrollID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,89 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/infrago/base"
+)
+
+func scrollRows(n int) []Map {
+	rows := make([]Map, 0, n)
+	for i := range n {
+		rows = append(rows, Map{"id": fmt.Sprintf("%02d", i), "title": "doc"})
+	}
+	return rows
+}
+
+func TestScroll(t *testing.T) {
+	c := newConn(t)
+	c.Upsert("p", scrollRows(25))
+
+	res, err := c.Search("p", BuildQuery("", Map{"$scroll": "1m", "$limit": 10}))
+	if err != nil || len(res.Hits) != 10 || res.Cursor == "" {
+		t.Fatalf("first page %+v %v", res, err)
+	}
+	// the scroll keeps the result set of its first page
+	c.Delete("p", []string{"15", "16"})
+	n := len(res.Hits)
+	for res.Cursor != "" {
+		if res, err = c.Search("p", BuildQuery("", Map{"$cursor": res.Cursor, "$limit": 10})); err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != 25 {
+			t.Fatalf("total %d while scrolling, want 25", res.Total)
+		}
+		n += len(res.Hits)
+	}
+	if n != 25 {
+		t.Fatalf("scrolled %d hits, want 25", n)
+	}
+
+	// nothing is kept when the result fits a page
+	c.Search("p", BuildQuery("", Map{"$scroll": "1m", "$limit": 100}))
+	if len(c.scrolls) != 1 {
+		t.Fatalf("%d scrolls kept, want 1", len(c.scrolls))
+	}
+}
+
+func TestScrollExpiry(t *testing.T) {
+	c := newConn(t)
+	c.Upsert("p", scrollRows(5))
+	res, _ := c.Search("p", BuildQuery("", Map{"$scroll": "10ms", "$limit": 2}))
+	time.Sleep(20 * time.Millisecond)
+
+	// any search drops expired scrolls
+	c.Search("p", BuildQuery(""))
+	c.scrollMutex.Lock()
+	kept := len(c.scrolls)
+	c.scrollMutex.Unlock()
+	if kept != 0 {
+		t.Fatalf("%d expired scrolls kept", kept)
+	}
+	if _, err := c.Search("p", BuildQuery("", Map{"$cursor": res.Cursor})); err == nil {
+		t.Fatal("expired scroll read")
+	}
+}
+
+func TestScrollLimit(t *testing.T) {
+	conn, err := (&defaultDriver{}).Connect(&Instance{Setting: Map{"max_scrolls": 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := conn.(*defaultConnection)
+	c.Upsert("p", scrollRows(5))
+	query := BuildQuery("", Map{"$scroll": "1m", "$limit": 2})
+	for range 2 {
+		if _, err := c.Search("p", query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.Search("p", query); err == nil {
+		t.Fatal("scroll kept beyond max_scrolls")
+	}
+	c.Close()
+	if _, err := c.Search("p", query); err != nil {
+		t.Fatalf("scroll after Close dropped the others: %v", err)
+	}
+}
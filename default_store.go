@@ -0,0 +1,591 @@
+package search
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/infrago/base"
+)
+
+// fsync policies of the default driver store.
+const (
+	FsyncAlways   = "always"
+	FsyncInterval = "interval"
+	FsyncNever    = "never"
+)
+
+const (
+	storeSnapshotFile = "snapshot.json"
+	storeSegmentExt   = ".wal"
+	// storeFrameHeader is the length and the crc32 of a log record.
+	storeFrameHeader = 8
+)
+
+// diskStore persists the default driver when Instance.Setting has a path:
+// Upsert, Delete and Clear are appended to write-ahead log segments before
+// they are applied, snapshots of all documents replace the segments they
+// cover from time to time, and Open replays both. A torn record at the
+// end of the log, left by a crash during a write, is cut off on replay. A
+// record that fails to be written or synced is cut off at once, when even
+// that fails the store refuses any further write until it is reopened.
+//
+// Settings: path, fsync (always, interval or never, default interval),
+// fsync_interval (default 1s), snapshot_interval (default 1m) and
+// snapshot_every (operations, default 10000).
+type diskStore struct {
+	path             string
+	fsync            string
+	fsyncInterval    time.Duration
+	snapshotInterval time.Duration
+	snapshotEvery    int
+
+	mutex   sync.Mutex
+	file    *os.File
+	size    int64
+	failed  error
+	seq     uint64
+	pending int
+	dirty   bool
+
+	// snapMutex serializes snapshots.
+	snapMutex sync.Mutex
+	trigger   chan struct{}
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// storeRecord is one logged write operation.
+type storeRecord struct {
+	Seq   uint64   `json:"seq"`
+	Op    string   `json:"op"`
+	Index string   `json:"index"`
+	Rows  []Map    `json:"rows,omitempty"`
+	IDs   []string `json:"ids,omitempty"`
+}
+
+// storeSnapshot holds every document of every index up to Seq.
+type storeSnapshot struct {
+	Seq     uint64                    `json:"seq"`
+	Indexes map[string]map[string]Map `json:"indexes"`
+}
+
+func newDiskStore(setting Map) (*diskStore, error) {
+	path, _ := setting["path"].(string)
+	if strings.TrimSpace(path) == "" {
+		return nil, nil
+	}
+	store := &diskStore{
+		path:             path,
+		fsync:            FsyncInterval,
+		fsyncInterval:    time.Second,
+		snapshotInterval: time.Minute,
+		snapshotEvery:    10000,
+	}
+	if v, ok := setting["fsync"].(string); ok && v != "" {
+		store.fsync = strings.ToLower(strings.TrimSpace(v))
+	}
+	switch store.fsync {
+	case FsyncAlways, FsyncInterval, FsyncNever:
+	default:
+		return nil, fmt.Errorf("invalid search fsync policy %s", store.fsync)
+	}
+	if v, ok := setting["fsync_interval"]; ok {
+		if d := parseDuration(v); d > 0 {
+			store.fsyncInterval = d
+		}
+	}
+	if v, ok := setting["snapshot_interval"]; ok {
+		if d := parseDuration(v); d > 0 {
+			store.snapshotInterval = d
+		}
+	}
+	if v, ok := toInt(setting["snapshot_every"]); ok && v > 0 {
+		store.snapshotEvery = v
+	}
+	return store, nil
+}
+
+// load reads the snapshot and replays the log through apply, then opens
+// the last segment for appending.
+func (s *diskStore) load(apply func(storeRecord)) error {
+	if err := os.MkdirAll(s.path, 0o755); err != nil {
+		return err
+	}
+	snap, err := s.readSnapshot()
+	if err != nil {
+		return err
+	}
+	for index, docs := range snap.Indexes {
+		rows := make([]Map, 0, len(docs))
+		for _, doc := range docs {
+			rows = append(rows, doc)
+		}
+		apply(storeRecord{Op: "upsert", Index: index, Rows: rows})
+	}
+	s.seq = snap.Seq
+
+	segments, err := s.segments()
+	if err != nil {
+		return err
+	}
+	for i, name := range segments {
+		last := i == len(segments)-1
+		if err := s.replay(name, snap.Seq, last, apply); err != nil {
+			return err
+		}
+	}
+
+	active := ""
+	if len(segments) > 0 {
+		active = segments[len(segments)-1]
+	}
+	return s.openSegment(active)
+}
+
+func (s *diskStore) readSnapshot() (storeSnapshot, error) {
+	snap := storeSnapshot{Indexes: map[string]map[string]Map{}}
+	data, err := os.ReadFile(filepath.Join(s.path, storeSnapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return snap, nil
+	}
+	if err != nil {
+		return snap, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&snap); err != nil {
+		return snap, fmt.Errorf("corrupt search snapshot %s: %w", s.path, err)
+	}
+	for _, docs := range snap.Indexes {
+		for id, doc := range docs {
+			docs[id] = normalizeStored(doc).(Map)
+		}
+	}
+	return snap, nil
+}
+
+// segments lists the log segments in write order, their names are the
+// zero padded sequence of their first record.
+func (s *diskStore) segments() ([]string, error) {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), storeSegmentExt) {
+			out = append(out, entry.Name())
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// replay applies the records of a segment newer than after. An incomplete
+// or corrupt record ends the last segment, which is truncated there, in
+// any other segment it is an error.
+func (s *diskStore) replay(name string, after uint64, last bool, apply func(storeRecord)) error {
+	path := filepath.Join(s.path, name)
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var offset int64
+	header := make([]byte, storeFrameHeader)
+	for {
+		record, size, err := readStoreRecord(file, header)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if !last {
+				return fmt.Errorf("corrupt search log %s at offset %d: %w", path, offset, err)
+			}
+			return os.Truncate(path, offset)
+		}
+		offset += size
+		if record.Seq > s.seq {
+			s.seq = record.Seq
+		}
+		if record.Seq > after {
+			apply(record)
+			s.pending++
+		}
+	}
+}
+
+func readStoreRecord(r io.Reader, header []byte) (storeRecord, int64, error) {
+	var record storeRecord
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return record, 0, io.EOF
+		}
+		return record, 0, fmt.Errorf("torn record header")
+	}
+	size := binary.BigEndian.Uint32(header[:4])
+	sum := binary.BigEndian.Uint32(header[4:])
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return record, 0, fmt.Errorf("torn record")
+	}
+	if crc32.ChecksumIEEE(payload) != sum {
+		return record, 0, fmt.Errorf("record checksum mismatch")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&record); err != nil {
+		return record, 0, err
+	}
+	for i, row := range record.Rows {
+		record.Rows[i] = normalizeStored(row).(Map)
+	}
+	return record, int64(storeFrameHeader + len(payload)), nil
+}
+
+// openSegment opens a segment for appending, a new one when name is empty.
+func (s *diskStore) openSegment(name string) error {
+	if name == "" {
+		name = fmt.Sprintf("%020d%s", s.seq+1, storeSegmentExt)
+	}
+	file, err := os.OpenFile(filepath.Join(s.path, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err == nil {
+		err = syncDir(s.path)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// append logs a record, it reports whether a snapshot is due.
+func (s *diskStore) append(record storeRecord) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return false, fmt.Errorf("search store is closed")
+	}
+	if s.failed != nil {
+		return false, fmt.Errorf("search store failed: %w", s.failed)
+	}
+	record.Seq = s.seq + 1
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return false, err
+	}
+	frame := make([]byte, storeFrameHeader, storeFrameHeader+len(payload))
+	binary.BigEndian.PutUint32(frame[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:], crc32.ChecksumIEEE(payload))
+	frame = append(frame, payload...)
+	_, err = s.file.Write(frame)
+	if err == nil && s.fsync == FsyncAlways {
+		err = s.file.Sync()
+	}
+	if err != nil {
+		// a torn frame would hide every later one on replay
+		if terr := s.file.Truncate(s.size); terr != nil {
+			s.failed = terr
+		}
+		return false, err
+	}
+	s.size += int64(len(frame))
+	s.dirty = s.fsync != FsyncAlways
+	s.seq = record.Seq
+	s.pending++
+	return s.pending >= s.snapshotEvery, nil
+}
+
+// sync flushes the active segment if it has unsynced writes.
+func (s *diskStore) sync() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil || !s.dirty {
+		return nil
+	}
+	s.dirty = false
+	return s.file.Sync()
+}
+
+// rotate starts a new segment and returns the last sequence of the old ones.
+// The old segment stays active when the new one can not be opened.
+func (s *diskStore) rotate() (uint64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.failed != nil {
+		// the failed segment must stay the last one to be cut on replay
+		return 0, fmt.Errorf("search store failed: %w", s.failed)
+	}
+	old := s.file
+	if old != nil {
+		if err := old.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	if err := s.openSegment(""); err != nil {
+		return 0, err
+	}
+	s.dirty = false
+	s.pending = 0
+	if old != nil {
+		if err := old.Close(); err != nil {
+			return 0, err
+		}
+	}
+	return s.seq, nil
+}
+
+// flush syncs the active segment and returns the last sequence, for the
+// final snapshot, which has no use for a new segment.
+func (s *diskStore) flush() (uint64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file != nil {
+		if err := s.file.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	s.dirty = false
+	s.pending = 0
+	return s.seq, nil
+}
+
+// writeSnapshot stores a snapshot atomically and drops the segments it
+// covers, every segment but the active one.
+func (s *diskStore) writeSnapshot(snap storeSnapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.path, storeSnapshotFile+".tmp")
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.path, storeSnapshotFile)); err != nil {
+		return err
+	}
+	if err := syncDir(s.path); err != nil {
+		return err
+	}
+
+	segments, err := s.segments()
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	active := ""
+	if s.file != nil {
+		active = filepath.Base(s.file.Name())
+	}
+	s.mutex.Unlock()
+	for _, name := range segments {
+		if name < active {
+			if err := os.Remove(filepath.Join(s.path, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *diskStore) close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Sync()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	s.file = nil
+	return err
+}
+
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	// some platforms can not sync directories, the rename is still done
+	_ = dir.Sync()
+	return nil
+}
+
+// normalizeStored turns decoded json back into the types the driver works
+// with, Map for objects and int64 or float64 for numbers. Dates come back
+// as RFC3339 strings, which filters and sorts still treat as dates.
+func normalizeStored(v Any) Any {
+	switch vv := v.(type) {
+	case Map:
+		for k, one := range vv {
+			vv[k] = normalizeStored(one)
+		}
+		return vv
+	case []Any:
+		for i, one := range vv {
+			vv[i] = normalizeStored(one)
+		}
+		return vv
+	case json.Number:
+		if n, err := strconv.ParseInt(vv.String(), 10, 64); err == nil {
+			return n
+		}
+		f, _ := vv.Float64()
+		return f
+	}
+	if m, ok := v.(map[string]Any); ok {
+		out := make(Map, len(m))
+		for k, one := range m {
+			out[k] = normalizeStored(one)
+		}
+		return out
+	}
+	return v
+}
+
+// startStore replays the store into the connection and starts the
+// background fsync and snapshot loop.
+func (c *defaultConnection) startStore() error {
+	s := c.store
+	err := s.load(func(record storeRecord) {
+		c.applyLocked(record)
+	})
+	if err != nil {
+		return err
+	}
+	s.trigger = make(chan struct{}, 1)
+	s.done = make(chan struct{})
+	s.wg.Add(1)
+	go c.storeLoop()
+	return nil
+}
+
+func (c *defaultConnection) storeLoop() {
+	s := c.store
+	defer s.wg.Done()
+	syncTicker := time.NewTicker(s.fsyncInterval)
+	defer syncTicker.Stop()
+	snapTicker := time.NewTicker(s.snapshotInterval)
+	defer snapTicker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-syncTicker.C:
+			if s.fsync == FsyncInterval {
+				_ = s.sync()
+			}
+		case <-snapTicker.C:
+			_ = c.snapshot(false)
+		case <-s.trigger:
+			_ = c.snapshot(false)
+		}
+	}
+}
+
+// stopStore stops the loop, writes a final snapshot and closes the log.
+func (c *defaultConnection) stopStore() error {
+	s := c.store
+	if s.done != nil {
+		close(s.done)
+		s.wg.Wait()
+		s.done = nil
+	}
+	err := c.snapshot(true)
+	if cerr := s.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// snapshot captures the documents together with a log rotation under the
+// connection lock, then writes them out without blocking writers. It does
+// nothing when no operation was logged since the last one, unless final:
+// the final snapshot of Close is always written and keeps the active
+// segment instead of leaving an empty one behind.
+func (c *defaultConnection) snapshot(final bool) error {
+	s := c.store
+	s.snapMutex.Lock()
+	defer s.snapMutex.Unlock()
+
+	c.mutex.Lock()
+	s.mutex.Lock()
+	idle := s.pending == 0
+	s.mutex.Unlock()
+	if idle && !final {
+		c.mutex.Unlock()
+		return nil
+	}
+	snap := storeSnapshot{Indexes: make(map[string]map[string]Map, len(c.indexes))}
+	for name, idx := range c.indexes {
+		idx.mutex.RLock()
+		docs := make(map[string]Map, len(idx.docs))
+		for id, doc := range idx.docs {
+			docs[id] = doc
+		}
+		idx.mutex.RUnlock()
+		snap.Indexes[name] = docs
+	}
+	rotate := s.rotate
+	if final {
+		rotate = s.flush
+	}
+	seq, err := rotate()
+	c.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	snap.Seq = seq
+	return s.writeSnapshot(snap)
+}
+
+// logLocked appends a write to the store, if any, the caller holds c.mutex.
+func (c *defaultConnection) logLocked(record storeRecord) error {
+	if c.store == nil {
+		return nil
+	}
+	due, err := c.store.append(record)
+	if err != nil {
+		return err
+	}
+	if due {
+		select {
+		case c.store.trigger <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
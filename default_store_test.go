@@ -0,0 +1,246 @@
+package search
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/infrago/base"
+)
+
+func connectStore(t *testing.T, dir string, extra Map) *defaultConnection {
+	t.Helper()
+	setting := Map{"path": dir, "fsync": FsyncAlways}
+	for k, v := range extra {
+		setting[k] = v
+	}
+	conn, err := (&defaultDriver{}).Connect(&Instance{Setting: setting})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn.(*defaultConnection)
+}
+
+func openStore(t *testing.T, dir string, extra Map) *defaultConnection {
+	t.Helper()
+	c := connectStore(t, dir, extra)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// crash stops a store without the final snapshot Close would write.
+func crash(c *defaultConnection) {
+	s := c.store
+	close(s.done)
+	s.wg.Wait()
+	s.done = nil
+	s.close()
+}
+
+func lastSegment(t *testing.T, c *defaultConnection) string {
+	t.Helper()
+	segments, err := c.store.segments()
+	if err != nil || len(segments) == 0 {
+		t.Fatalf("segments: %v %v", segments, err)
+	}
+	return filepath.Join(c.store.path, segments[len(segments)-1])
+}
+
+func TestStoreReplay(t *testing.T) {
+	dir := t.TempDir()
+	c := openStore(t, dir, nil)
+	c.Upsert("a", []Map{
+		{"id": "1", "title": "hello", "n": 5, "tags": []Any{"x", Map{"k": 1.5}}},
+		{"id": "2", "title": "world"},
+	})
+	c.Delete("a", []string{"2"})
+	c.Upsert("b", []Map{{"id": "9", "title": "bee"}})
+	c.Clear("b")
+	crash(c)
+
+	c = openStore(t, dir, nil)
+	defer c.Close()
+	if got := docIDs(c, "a"); got != "1" {
+		t.Fatalf("index a = %q, want 1", got)
+	}
+	if got := docIDs(c, "b"); got != "" {
+		t.Fatalf("index b = %q, want empty", got)
+	}
+	doc := c.indexes["a"].docs["1"]
+	if _, ok := doc["n"].(int64); !ok {
+		t.Fatalf("n replayed as %T, want int64", doc["n"])
+	}
+	if _, ok := doc["tags"].([]Any)[1].(Map); !ok {
+		t.Fatalf("tags replayed as %#v", doc["tags"])
+	}
+}
+
+func TestStoreSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	c := openStore(t, dir, Map{"snapshot_every": 2})
+	for i := range 10 {
+		c.Upsert("a", []Map{{"id": fmt.Sprint(i)}})
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	segments, _ := c.store.segments()
+	if len(segments) != 1 {
+		t.Fatalf("segments after snapshot = %v, want only the active one", segments)
+	}
+
+	c = openStore(t, dir, nil)
+	defer c.Close()
+	if n := len(c.indexes["a"].docs); n != 10 {
+		t.Fatalf("replayed %d docs, want 10", n)
+	}
+}
+
+func TestStoreCloseKeepsSegment(t *testing.T) {
+	dir := t.TempDir()
+	c := openStore(t, dir, nil)
+	c.Upsert("a", []Map{{"id": "1"}, {"id": "2"}})
+	active := lastSegment(t, c)
+	for range 3 {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+		c = openStore(t, dir, nil)
+	}
+	defer c.Close()
+	if segments, _ := c.store.segments(); len(segments) != 1 || lastSegment(t, c) != active {
+		t.Fatalf("segments after restarts = %v, want only %s", segments, filepath.Base(active))
+	}
+	if got := docIDs(c, "a"); got != "1,2" {
+		t.Fatalf("replayed %q, want 1,2", got)
+	}
+}
+
+func TestStoreTruncatesTornTail(t *testing.T) {
+	dir := t.TempDir()
+	c := openStore(t, dir, nil)
+	c.Upsert("a", []Map{{"id": "1"}})
+	c.Upsert("a", []Map{{"id": "2"}})
+	path := lastSegment(t, c)
+	info, _ := os.Stat(path)
+	complete := info.Size()
+	c.Upsert("a", []Map{{"id": "3", "title": "torn"}})
+	crash(c)
+
+	// cut the last frame in the middle of its payload
+	info, _ = os.Stat(path)
+	if err := os.Truncate(path, complete+(info.Size()-complete)/2); err != nil {
+		t.Fatal(err)
+	}
+
+	c = openStore(t, dir, nil)
+	if got := docIDs(c, "a"); got != "1,2" {
+		t.Fatalf("replayed %q, want 1,2", got)
+	}
+	info, _ = os.Stat(path)
+	if info.Size() != complete {
+		t.Fatalf("segment is %d bytes after replay, want %d", info.Size(), complete)
+	}
+
+	// writes after the cut replay too
+	c.Upsert("a", []Map{{"id": "4"}})
+	crash(c)
+	c = openStore(t, dir, nil)
+	defer c.Close()
+	if got := docIDs(c, "a"); got != "1,2,4" {
+		t.Fatalf("replayed %q, want 1,2,4", got)
+	}
+}
+
+func TestStoreCorruptSegment(t *testing.T) {
+	dir := t.TempDir()
+	c := openStore(t, dir, nil)
+	c.Upsert("a", []Map{{"id": "1", "title": "first"}})
+	first := lastSegment(t, c)
+	if _, err := c.store.rotate(); err != nil {
+		t.Fatal(err)
+	}
+	c.Upsert("a", []Map{{"id": "2"}})
+	crash(c)
+
+	data, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-2] ^= 0xff
+	if err := os.WriteFile(first, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c = connectStore(t, dir, nil)
+	err = c.Open()
+	if err == nil || !strings.Contains(err.Error(), "corrupt search log") {
+		t.Fatalf("Open = %v, want a corrupt log error", err)
+	}
+}
+
+func TestStoreRotateFailure(t *testing.T) {
+	dir := t.TempDir()
+	c := openStore(t, dir, nil)
+	c.Upsert("a", []Map{{"id": "1"}})
+
+	// a directory in place of the next segment makes it impossible to open
+	next := filepath.Join(dir, fmt.Sprintf("%020d%s", c.store.seq+1, storeSegmentExt))
+	if err := os.Mkdir(next, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.store.rotate(); err == nil {
+		t.Fatal("rotate succeeded without a segment to open")
+	}
+	if err := c.Upsert("a", []Map{{"id": "2"}}); err != nil {
+		t.Fatalf("upsert after a failed rotation: %v", err)
+	}
+	crash(c)
+	os.Remove(next)
+
+	c = openStore(t, dir, nil)
+	defer c.Close()
+	if got := docIDs(c, "a"); got != "1,2" {
+		t.Fatalf("replayed %q, want 1,2", got)
+	}
+}
+
+func TestStoreFailedAppend(t *testing.T) {
+	dir := t.TempDir()
+	c := openStore(t, dir, nil)
+	c.Upsert("a", []Map{{"id": "1"}})
+
+	// neither the write nor the truncation can reach a closed file
+	c.store.file.Close()
+	if err := c.Upsert("a", []Map{{"id": "2"}}); err == nil {
+		t.Fatal("upsert logged to a closed file")
+	}
+	file, err := os.OpenFile(lastSegment(t, c), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.store.file = file
+	if err := c.Upsert("a", []Map{{"id": "3"}}); err == nil || !strings.Contains(err.Error(), "store failed") {
+		t.Fatalf("upsert after a failed append = %v, want the store failed", err)
+	}
+	if _, err := c.store.rotate(); err == nil {
+		t.Fatal("failed store rotated")
+	}
+	if got := docIDs(c, "a"); got != "1" {
+		t.Fatalf("index a = %q, want 1", got)
+	}
+	crash(c)
+
+	c = openStore(t, dir, nil)
+	defer c.Close()
+	if got := docIDs(c, "a"); got != "1" {
+		t.Fatalf("replayed %q, want 1", got)
+	}
+	if err := c.Upsert("a", []Map{{"id": "4"}}); err != nil {
+		t.Fatalf("upsert after reopening: %v", err)
+	}
+}
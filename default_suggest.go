@@ -0,0 +1,267 @@
+package search
+
+import (
+	"container/heap"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// suggestTrie is a prefix trie of words with the documents containing
+// each of them.
+type suggestTrie struct {
+	root *trieNode
+}
+
+type trieNode struct {
+	children map[rune]*trieNode
+	docs     map[string]struct{}
+	// best is the highest document count in the subtree, collect visits
+	// subtrees in its order.
+	best int
+}
+
+func newSuggestTrie() *suggestTrie {
+	return &suggestTrie{root: &trieNode{}}
+}
+
+// add records that a document contains word.
+func (t *suggestTrie) add(word, id string) {
+	path := []*trieNode{t.root}
+	node := t.root
+	for _, r := range word {
+		child, ok := node.children[r]
+		if !ok {
+			if node.children == nil {
+				node.children = map[rune]*trieNode{}
+			}
+			child = &trieNode{}
+			node.children[r] = child
+		}
+		node = child
+		path = append(path, node)
+	}
+	if node.docs == nil {
+		node.docs = map[string]struct{}{}
+	}
+	node.docs[id] = struct{}{}
+	updateBest(path)
+}
+
+// remove forgets that a document contains word, nodes left empty are
+// pruned.
+func (t *suggestTrie) remove(word, id string) {
+	runes := []rune(word)
+	path := []*trieNode{t.root}
+	node := t.root
+	for _, r := range runes {
+		child, ok := node.children[r]
+		if !ok {
+			return
+		}
+		node = child
+		path = append(path, node)
+	}
+	delete(node.docs, id)
+	for i := len(runes); i > 0; i-- {
+		if len(path[i].docs) > 0 || len(path[i].children) > 0 {
+			break
+		}
+		delete(path[i-1].children, runes[i-1])
+		path = path[:i]
+	}
+	updateBest(path)
+}
+
+// updateBest recomputes the best counts of a path from the root, up to
+// the first node that keeps its count.
+func updateBest(path []*trieNode) {
+	for i := len(path) - 1; i >= 0; i-- {
+		node := path[i]
+		best := len(node.docs)
+		for _, child := range node.children {
+			best = max(best, child.best)
+		}
+		if node.best == best {
+			return
+		}
+		node.best = best
+	}
+}
+
+// lookup returns the documents containing word.
+func (t *suggestTrie) lookup(word string) map[string]struct{} {
+	node := t.root
+	for _, r := range word {
+		if node = node.children[r]; node == nil {
+			return nil
+		}
+	}
+	return node.docs
+}
+
+// collect calls fn for the words starting with prefix in suggestion
+// order, most documents first, then shortest, until it returns false.
+// Subtrees are walked best count first, so a short prefix only visits
+// the nodes leading to what is returned.
+func (t *suggestTrie) collect(prefix string, fn func(word string) bool) {
+	node := t.root
+	for _, r := range prefix {
+		if node = node.children[r]; node == nil {
+			return
+		}
+	}
+	queue := &trieQueue{{node: node, word: prefix, count: node.best}}
+	for queue.Len() > 0 {
+		one := heap.Pop(queue).(trieEntry)
+		if one.leaf {
+			if !fn(one.word) {
+				return
+			}
+			continue
+		}
+		if len(one.node.docs) > 0 {
+			heap.Push(queue, trieEntry{node: one.node, word: one.word, count: len(one.node.docs), leaf: true})
+		}
+		for r, child := range one.node.children {
+			heap.Push(queue, trieEntry{node: child, word: one.word + string(r), count: child.best})
+		}
+	}
+}
+
+// trieEntry is a word, or a subtree whose words count at most count
+// documents, waiting in the collect queue.
+type trieEntry struct {
+	node  *trieNode
+	word  string
+	count int
+	leaf  bool
+}
+
+// trieQueue orders entries like suggestions, a subtree sorts before the
+// words in it as its word is their prefix.
+type trieQueue []trieEntry
+
+func (q trieQueue) Len() int { return len(q) }
+func (q trieQueue) Less(i, j int) bool {
+	a, b := q[i], q[j]
+	if a.count == b.count && a.word == b.word {
+		return a.leaf && !b.leaf
+	}
+	return suggestLess(a.word, a.count, b.word, b.count)
+}
+func (q trieQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *trieQueue) Push(x any)   { *q = append(*q, x.(trieEntry)) }
+func (q *trieQueue) Pop() any {
+	old := *q
+	one := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return one
+}
+
+// suggestLess ranks suggestions by document count, then length, then
+// text.
+func suggestLess(a string, ca int, b string, cb int) bool {
+	if ca != cb {
+		return ca > cb
+	}
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// docCount counts the documents containing word in any of the tries.
+func docCount(tries []*suggestTrie, word string) int {
+	if len(tries) == 1 {
+		return len(tries[0].lookup(word))
+	}
+	docs := map[string]struct{}{}
+	for _, trie := range tries {
+		for id := range trie.lookup(word) {
+			docs[id] = struct{}{}
+		}
+	}
+	return len(docs)
+}
+
+// suggestions completes the last word of the query prefix, ranked by the
+// documents containing it in any of the suggestable fields. With several
+// fields listed the candidates are the best words of each field.
+func (idx *memoryIndex) suggestions(query SuggestQuery) []Suggestion {
+	text := idx.analyzer.filter(query.Prefix)
+	start := len(text)
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(text[:start])
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.Is(unicode.Mn, r) {
+			break
+		}
+		start -= size
+	}
+	if tokens := idx.analyzer.tokenize(text); len(tokens) > 0 {
+		last := tokens[len(tokens)-1]
+		if last.End == len(text) && last.Start > start {
+			start = last.Start
+		}
+	}
+	if start == len(text) {
+		return []Suggestion{}
+	}
+	lead, key := text[:start], strings.ToLower(text[start:])
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+
+	tries := []*suggestTrie{idx.suggest}
+	if len(query.Fields) > 0 {
+		tries = tries[:0]
+		for name, fi := range idx.fields {
+			if fi.suggest != nil && fieldListed(name, query.Fields) {
+				tries = append(tries, fi.suggest)
+			}
+		}
+	}
+
+	counts := map[string]int{}
+	for _, trie := range tries {
+		n := 0
+		trie.collect(key, func(word string) bool {
+			counts[word] = 0
+			n++
+			return n < limit
+		})
+	}
+	for word := range counts {
+		counts[word] = docCount(tries, word)
+	}
+
+	words := make([]string, 0, len(counts))
+	for word := range counts {
+		words = append(words, word)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		return suggestLess(words[i], counts[words[i]], words[j], counts[words[j]])
+	})
+	if len(words) > limit {
+		words = words[:limit]
+	}
+
+	out := make([]Suggestion, 0, len(words))
+	for _, word := range words {
+		count := int64(counts[word])
+		out = append(out, Suggestion{Text: lead + word, Count: count, Score: float64(count)})
+	}
+	return out
+}
+
+// fieldListed reports whether a field or one of its parents is listed.
+func fieldListed(name string, fields []string) bool {
+	for _, one := range fields {
+		if name == one || strings.HasPrefix(name, one+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package search
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"testing"
+
+	. "github.com/infrago/base"
+)
+
+func TestSuggest(t *testing.T) {
+	c := newConn(t)
+	c.SyncIndex("s", Index{Language: "en"})
+	c.Upsert("s", []Map{
+		{"id": "1", "title": "Machine learning basics"},
+		{"id": "2", "title": "Learning Go"},
+		{"id": "3", "title": "Lean startup"},
+	})
+	out, err := c.Suggest("s", BuildSuggestQuery("machine lea"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 || out[0].Text != "machine learning" || out[0].Count != 2 || out[1].Text != "machine lean" {
+		t.Fatalf("suggested %+v", out)
+	}
+
+	c.Delete("s", []string{"1", "2"})
+	out, _ = c.Suggest("s", BuildSuggestQuery("lea"))
+	if len(out) != 1 || out[0].Text != "lean" {
+		t.Fatalf("suggested %+v after delete", out)
+	}
+}
+
+func TestSuggestCountsDocuments(t *testing.T) {
+	c := newConn(t)
+	c.Upsert("s", []Map{
+		{"id": "1", "title": "golang tips", "body": "golang in depth", "tags": []Any{"golang"}},
+		{"id": "2", "title": "gopher", "body": "golang"},
+	})
+	out, _ := c.Suggest("s", BuildSuggestQuery("go"))
+	if len(out) != 2 || out[0].Text != "golang" || out[0].Count != 2 || out[1].Count != 1 {
+		t.Fatalf("suggested %+v, want golang in 2 documents", out)
+	}
+	out, _ = c.Suggest("s", BuildSuggestQuery("go", Map{"$fields": "title,body"}))
+	if len(out) != 2 || out[0].Text != "golang" || out[0].Count != 2 {
+		t.Fatalf("suggested %+v over title and body", out)
+	}
+	out, _ = c.Suggest("s", BuildSuggestQuery("go", Map{"$fields": "title"}))
+	if len(out) != 2 || out[0].Count != 1 || out[1].Count != 1 {
+		t.Fatalf("suggested %+v over title", out)
+	}
+}
+
+func TestSuggestTrie(t *testing.T) {
+	trie := newSuggestTrie()
+	words := []string{"a", "ab", "abc", "abd", "b", "ba", "bab", "c"}
+	want := map[string]int{}
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := range 200 {
+		word := words[rng.IntN(len(words))]
+		id := fmt.Sprint(i % 40)
+		trie.add(word, id)
+		if rng.IntN(3) == 0 {
+			trie.remove(word, id)
+		}
+	}
+	for _, word := range words {
+		want[word] = len(trie.lookup(word))
+	}
+
+	for _, prefix := range []string{"a", "b", "ab", "c", "x"} {
+		expect := make([]string, 0)
+		for _, word := range words {
+			if want[word] > 0 && len(word) >= len(prefix) && word[:len(prefix)] == prefix {
+				expect = append(expect, word)
+			}
+		}
+		sort.Slice(expect, func(i, j int) bool {
+			return suggestLess(expect[i], want[expect[i]], expect[j], want[expect[j]])
+		})
+		for limit := 1; limit <= len(expect); limit++ {
+			got := make([]string, 0, limit)
+			trie.collect(prefix, func(word string) bool {
+				got = append(got, word)
+				return len(got) < limit
+			})
+			if fmt.Sprint(got) != fmt.Sprint(expect[:limit]) {
+				t.Fatalf("collect(%q, %d) = %v, want %v", prefix, limit, got, expect[:limit])
+			}
+		}
+	}
+
+	// removing every document prunes the trie
+	for _, word := range words {
+		for id := range trie.lookup(word) {
+			trie.remove(word, id)
+		}
+	}
+	if len(trie.root.children) != 0 || trie.root.best != 0 {
+		t.Fatalf("trie not pruned: %d children, best %d", len(trie.root.children), trie.root.best)
+	}
+}
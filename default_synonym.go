@@ -0,0 +1,108 @@
+package search
+
+import "strings"
+
+// synonymTable maps the analyzed terms of a synonym input to the analyzed
+// term sequences it expands to, for one analyzer.
+type synonymTable struct {
+	rules  map[string][][]string
+	maxLen int
+}
+
+func compileSynonyms(analyzer Analyzer, synonyms []Synonym) *synonymTable {
+	table := &synonymTable{rules: map[string][][]string{}}
+	add := func(input string, outputs []string) {
+		in := analyzer.Terms(input)
+		if len(in) == 0 {
+			return
+		}
+		key := strings.Join(in, "\x00")
+		seen := map[string]struct{}{key: {}}
+		for _, one := range table.rules[key] {
+			seen[strings.Join(one, "\x00")] = struct{}{}
+		}
+		for _, output := range outputs {
+			terms := analyzer.Terms(output)
+			if _, ok := seen[strings.Join(terms, "\x00")]; ok || len(terms) == 0 {
+				continue
+			}
+			seen[strings.Join(terms, "\x00")] = struct{}{}
+			table.rules[key] = append(table.rules[key], terms)
+		}
+		table.maxLen = max(table.maxLen, len(in))
+	}
+	for _, synonym := range synonyms {
+		if len(synonym.Input) > 0 {
+			for _, input := range synonym.Input {
+				add(input, synonym.Terms)
+			}
+			continue
+		}
+		for _, term := range synonym.Terms {
+			add(term, synonym.Terms)
+		}
+	}
+	return table
+}
+
+// expand groups query terms into clauses of alternatives, the first one
+// being the original terms, the longest synonym input wins.
+func (t *synonymTable) expand(terms []string) [][][]string {
+	out := make([][][]string, 0, len(terms))
+	for i := 0; i < len(terms); {
+		matched := 0
+		if t != nil {
+			for n := min(t.maxLen, len(terms)-i); n > 0; n-- {
+				if outputs, ok := t.rules[strings.Join(terms[i:i+n], "\x00")]; ok {
+					clause := append([][]string{terms[i : i+n]}, outputs...)
+					out = append(out, clause)
+					matched = n
+					break
+				}
+			}
+		}
+		if matched == 0 {
+			out = append(out, [][]string{terms[i : i+1]})
+			matched = 1
+		}
+		i += matched
+	}
+	return out
+}
+
+// compileSynonyms prepares the synonym tables of every analyzer in use.
+func (idx *memoryIndex) compileSynonyms() {
+	idx.synonymTables = map[string]*synonymTable{}
+	if len(idx.synonyms) == 0 {
+		return
+	}
+	idx.synonymTables[idx.analyzer.Name] = compileSynonyms(idx.analyzer, idx.synonyms)
+	for _, analyzer := range idx.analyzers {
+		if _, ok := idx.synonymTables[analyzer.Name]; !ok {
+			idx.synonymTables[analyzer.Name] = compileSynonyms(analyzer, idx.synonyms)
+		}
+	}
+}
+
+// synonymVariants returns the terms the query terms expand to, for
+// highlighting.
+func (idx *memoryIndex) synonymVariants(analyzer Analyzer, terms []string) []string {
+	out := make([]string, 0)
+	for _, clause := range idx.synonymTables[analyzer.Name].expand(terms) {
+		for _, alt := range clause[1:] {
+			out = append(out, alt...)
+		}
+	}
+	return out
+}
+
+func (c *defaultConnection) UpdateSynonyms(index string, synonyms []Synonym) error {
+	c.mutex.Lock()
+	idx := c.ensure(index)
+	c.mutex.Unlock()
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	idx.synonyms = synonyms
+	idx.compileSynonyms()
+	return nil
+}
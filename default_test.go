@@ -0,0 +1,31 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+// newConn is a memory only connection of the default driver.
+func newConn(t *testing.T) *defaultConnection {
+	t.Helper()
+	conn, err := (&defaultDriver{}).Connect(&Instance{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn.(*defaultConnection)
+}
+
+// docIDs lists the documents of an index, sorted and comma separated.
+func docIDs(c *defaultConnection, index string) string {
+	idx := c.indexes[index]
+	if idx == nil {
+		return ""
+	}
+	ids := make([]string, 0, len(idx.docs))
+	for id := range idx.docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
@@ -1,6 +1,11 @@
 package search
 
-import . "github.com/infrago/base"
+import (
+	"context"
+	"time"
+
+	. "github.com/infrago/base"
+)
 
 type (
 	Capabilities struct {
@@ -12,9 +17,17 @@ type (
 		Count     bool
 		Suggest   bool
 
-		Sort      bool
-		Facets    bool
-		Highlight bool
+		Sort         bool
+		Facets       bool
+		Highlight    bool
+		SearchFields bool
+		BoolFilters  bool
+		RangeFacets  bool
+		Fuzzy        bool
+		Phrases      bool
+		TermClauses  bool
+		Cursor       bool
+		Scroll       bool
 
 		FilterOps []string
 	}
@@ -36,6 +49,41 @@ type (
 		Count(index string, query Query) (int64, error)
 	}
 
+	// ContextConnection is implemented by connections that honour
+	// cancellation and deadlines, the module waits for other connections
+	// only until the context is done.
+	ContextConnection interface {
+		ClearContext(ctx context.Context, index string) error
+		UpsertContext(ctx context.Context, index string, rows []Map) error
+		DeleteContext(ctx context.Context, index string, ids []string) error
+		SearchContext(ctx context.Context, index string, query Query) (Result, error)
+		CountContext(ctx context.Context, index string, query Query) (int64, error)
+	}
+
+	// Pinger is implemented by connections that can report whether their
+	// backend is reachable, the module checks them in the background.
+	Pinger interface {
+		Ping() error
+	}
+
+	// Retrier is implemented by connections that know which of their
+	// errors are transient and worth retrying.
+	Retrier interface {
+		Retryable(err error) bool
+	}
+
+	// Suggester is implemented by connections that support completion,
+	// they also report Capabilities.Suggest.
+	Suggester interface {
+		Suggest(index string, query SuggestQuery) ([]Suggestion, error)
+	}
+
+	// SynonymUpdater is implemented by connections that can replace the
+	// synonyms of an index without re-indexing it.
+	SynonymUpdater interface {
+		UpdateSynonyms(index string, synonyms []Synonym) error
+	}
+
 	Index struct {
 		Name        string
 		Desc        string
@@ -44,20 +92,36 @@ type (
 		StrictWrite bool
 		StrictRead  bool
 		Fields      Map
+		Schema      Fields
 		Language    string
 		Analyzer    string
+		Synonyms    []Synonym
+		StopWords   []string
+		Instances   []string
+		Replicas    int
+		Consistency string
 		Setting     Map
 	}
 
+	// Synonym declares equivalent Terms, or when Input is set a one way
+	// expansion of Input to Terms, see ParseSynonyms.
+	Synonym struct {
+		Input []string
+		Terms []string
+	}
+
 	Indexes map[string]Index
 
+	// Filter is a field condition, or a logical node (and/or/nor/not)
+	// over Filters when Op is one of the logical operators.
 	Filter struct {
-		Field  string
-		Op     string
-		Value  Any
-		Values []Any
-		Min    Any
-		Max    Any
+		Field   string
+		Op      string
+		Value   Any
+		Values  []Any
+		Min     Any
+		Max     Any
+		Filters []Filter
 	}
 
 	Sort struct {
@@ -65,6 +129,41 @@ type (
 		Desc  bool
 	}
 
+	// Fuzzy enables typo tolerance, a keyword term matches terms within
+	// Distance edits of it (FuzzyAuto picks it from the term length) and
+	// sharing its first PrefixLength characters. Zero Distance disables it.
+	Fuzzy struct {
+		Distance     int
+		PrefixLength int
+	}
+
+	// Phrase requires its words adjacent and in order, or with Slop set,
+	// within Slop position moves of each other.
+	Phrase struct {
+		Text string
+		Slop int
+	}
+
+	// FieldBoost restricts keyword matching to a field with a weight.
+	FieldBoost struct {
+		Field string
+		Boost float64
+	}
+
+	// RangeFacet counts hits per range of a numeric or date field.
+	RangeFacet struct {
+		Field  string
+		Ranges []FacetRange
+	}
+
+	// FacetRange is one bucket of a RangeFacet, From is inclusive and To
+	// exclusive, either may be nil, both may be relative dates like "now-7d".
+	FacetRange struct {
+		Key  string
+		From Any
+		To   Any
+	}
+
 	Facet struct {
 		Field string
 		Value string
@@ -78,18 +177,47 @@ type (
 		Highlight Map     `json:"highlight,omitempty"`
 	}
 
+	// Query pages with Offset and Limit, or with Cursor taken from the
+	// previous Result, which continues after its last hit (Offset is then
+	// ignored). A positive Scroll keeps the whole result set for that long
+	// so that later pages stay consistent while documents change. Every
+	// group of Should needs one of its alternatives to match, a keyword or
+	// quoted phrase, and each matching alternative adds to the score.
 	Query struct {
-		Keyword   string
-		Prefix    bool
-		Filters   []Filter
-		Sorts     []Sort
-		Offset    int
-		Limit     int
-		Fields    []string
-		Facets    []string
-		Highlight []string
-		Raw       Map
-		Setting   Map
+		Keyword      string
+		Prefix       bool
+		Syntax       bool
+		Required     []string
+		Excluded     []string
+		Should       [][]string
+		Fuzzy        Fuzzy
+		Phrases      []Phrase
+		SearchFields []FieldBoost
+		Filters      []Filter
+		Sorts        []Sort
+		Offset       int
+		Limit        int
+		Cursor       string
+		Scroll       time.Duration
+		Fields       []string
+		Facets       []string
+		RangeFacets  []RangeFacet
+		Highlight    []string
+		Raw          Map
+		Setting      Map
+	}
+
+	SuggestQuery struct {
+		Prefix  string
+		Fields  []string
+		Limit   int
+		Setting Map
+	}
+
+	Suggestion struct {
+		Text  string  `json:"text"`
+		Count int64   `json:"count"`
+		Score float64 `json:"score"`
 	}
 
 	Result struct {
@@ -97,6 +225,7 @@ type (
 		Took   int64              `json:"took"`
 		Hits   []Hit              `json:"hits"`
 		Facets map[string][]Facet `json:"facets,omitempty"`
+		Cursor string             `json:"cursor,omitempty"`
 		Raw    Any                `json:"raw,omitempty"`
 	}
 )
@@ -1,11 +1,20 @@
 package search
 
-import . "github.com/infrago/base"
+import (
+	"context"
+	"iter"
+
+	. "github.com/infrago/base"
+)
 
 func Clear(index string) error {
 	return module.Clear(index)
 }
 
+func ClearContext(ctx context.Context, index string) error {
+	return module.ClearContext(ctx, index)
+}
+
 func GetCapabilities(index string) Capabilities {
 	return module.Capabilities(index)
 }
@@ -14,22 +23,82 @@ func ListCapabilities() map[string]Capabilities {
 	return module.ListCapabilities()
 }
 
+func Health() map[string]InstanceHealth {
+	return module.Health()
+}
+
+func ListIndexes() map[string][]string {
+	return module.ListIndexes()
+}
+
+func GetAnalyzer(name string) (Analyzer, bool) {
+	return module.Analyzer(name)
+}
+
+func IndexAnalyzer(index Index) Analyzer {
+	return module.IndexAnalyzer(index)
+}
+
+func Analyze(index, text string) []Token {
+	return module.Analyze(index, text)
+}
+
+func AddWords(words ...string) {
+	module.AddWords(words...)
+}
+
 func Upsert(index string, rows ...Map) error {
 	return module.Upsert(index, rows...)
 }
 
+func UpsertContext(ctx context.Context, index string, rows ...Map) error {
+	return module.UpsertContext(ctx, index, rows...)
+}
+
 func Delete(index string, ids []string) error {
 	return module.Delete(index, ids)
 }
 
+func DeleteContext(ctx context.Context, index string, ids []string) error {
+	return module.DeleteContext(ctx, index, ids)
+}
+
 func Search(index, keyword string, args ...Any) (Result, error) {
 	return module.Search(index, keyword, args...)
 }
 
+func SearchContext(ctx context.Context, index, keyword string, args ...Any) (Result, error) {
+	return module.SearchContext(ctx, index, keyword, args...)
+}
+
 func Count(index, keyword string, args ...Any) (int64, error) {
 	return module.Count(index, keyword, args...)
 }
 
+func CountContext(ctx context.Context, index, keyword string, args ...Any) (int64, error) {
+	return module.CountContext(ctx, index, keyword, args...)
+}
+
+func Scan(index, keyword string, args ...Any) iter.Seq2[Hit, error] {
+	return module.Scan(index, keyword, args...)
+}
+
+func ScanContext(ctx context.Context, index, keyword string, args ...Any) iter.Seq2[Hit, error] {
+	return module.ScanContext(ctx, index, keyword, args...)
+}
+
+func Suggest(index, prefix string, args ...Any) ([]Suggestion, error) {
+	return module.Suggest(index, prefix, args...)
+}
+
+func SuggestContext(ctx context.Context, index, prefix string, args ...Any) ([]Suggestion, error) {
+	return module.SuggestContext(ctx, index, prefix, args...)
+}
+
+func UpdateSynonyms(index string, synonyms []Synonym) error {
+	return module.UpdateSynonyms(index, synonyms)
+}
+
 func Signature(index, keyword string, args ...Any) string {
 	return QuerySignature(index, BuildQuery(keyword, args...))
 }
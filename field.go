@@ -0,0 +1,203 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	. "github.com/infrago/base"
+)
+
+const (
+	FieldText    = "text"
+	FieldKeyword = "keyword"
+	FieldInt     = "int"
+	FieldFloat   = "float"
+	FieldBool    = "bool"
+	FieldDate    = "date"
+	FieldGeo     = "geo"
+	FieldVector  = "vector"
+)
+
+type (
+	// Field is the normalized schema of one index field, parsed from
+	// Index.Fields and handed to drivers as Index.Schema.
+	Field struct {
+		Name       string
+		Type       string
+		Searchable bool
+		Filterable bool
+		Sortable   bool
+		Facetable  bool
+		Stored     bool
+		Suggest    bool
+		Analyzer   string
+		Boost      float64
+	}
+
+	Fields map[string]Field
+)
+
+// Names returns the field names in a stable order.
+func (fs Fields) Names() []string {
+	out := make([]string, 0, len(fs))
+	for name := range fs {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Searchable returns the searchable fields in a stable order.
+func (fs Fields) Searchable() []Field {
+	out := make([]Field, 0, len(fs))
+	for _, name := range fs.Names() {
+		if fs[name].Searchable {
+			out = append(out, fs[name])
+		}
+	}
+	return out
+}
+
+// Lookup returns the field declared for a path, a nested path such as
+// "author.name" falls back to its closest declared parent.
+func (fs Fields) Lookup(path string) (Field, bool) {
+	for path != "" {
+		if field, ok := fs[path]; ok {
+			return field, true
+		}
+		pos := strings.LastIndex(path, ".")
+		if pos < 0 {
+			break
+		}
+		path = path[:pos]
+	}
+	return Field{}, false
+}
+
+// parseFields turns Index.Fields into a schema, a field can be declared by
+// type only ("title": "text") or with options:
+// "title": Map{"type": "text", "boost": 3, "sortable": true, "analyzer": "cjk"}
+func parseFields(cfg Map) (Fields, error) {
+	out := Fields{}
+	for name, val := range cfg {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		field := Field{Name: name}
+		var opts Map
+		switch vv := val.(type) {
+		case string:
+			field.Type = vv
+		case Field:
+			field = vv
+			field.Name = name
+		case Map:
+			opts = vv
+			if v, ok := vv["type"].(string); ok {
+				field.Type = v
+			}
+		default:
+			return nil, fmt.Errorf("field %s has invalid definition %v", name, val)
+		}
+		field.Type = strings.ToLower(strings.TrimSpace(field.Type))
+		if field.Type == "" {
+			field.Type = FieldText
+		}
+		if _, isField := val.(Field); !isField {
+			field = fieldDefaults(field)
+		}
+
+		if opts != nil {
+			for key, flag := range map[string]*bool{
+				"searchable": &field.Searchable,
+				"filterable": &field.Filterable,
+				"sortable":   &field.Sortable,
+				"facetable":  &field.Facetable,
+				"stored":     &field.Stored,
+				"suggest":    &field.Suggest,
+			} {
+				if raw, ok := opts[key]; ok {
+					v, ok := parseBool(raw)
+					if !ok {
+						return nil, fmt.Errorf("field %s has invalid %s %v", name, key, raw)
+					}
+					*flag = v
+				}
+			}
+			if _, ok := opts["suggest"]; !ok && field.Type == FieldText {
+				// suggestions come from the search terms, a text field
+				// left out of search is left out of suggestions too
+				field.Suggest = field.Searchable
+			}
+			if v, ok := opts["analyzer"].(string); ok {
+				field.Analyzer = strings.TrimSpace(v)
+			}
+			if raw, ok := opts["boost"]; ok {
+				boost, ok := toFloat(raw)
+				if !ok {
+					return nil, fmt.Errorf("field %s has invalid boost %v", name, raw)
+				}
+				field.Boost = boost
+			}
+		}
+
+		if err := checkField(field); err != nil {
+			return nil, err
+		}
+		if field.Boost == 0 {
+			field.Boost = 1
+		}
+		out[name] = field
+	}
+	return out, nil
+}
+
+// fieldDefaults applies the flags implied by the field type.
+func fieldDefaults(field Field) Field {
+	field.Stored = true
+	switch field.Type {
+	case FieldText:
+		field.Searchable = true
+		field.Suggest = true
+	case FieldKeyword, FieldInt, FieldFloat, FieldDate:
+		field.Filterable = true
+		field.Sortable = true
+		field.Facetable = true
+	case FieldBool:
+		field.Filterable = true
+		field.Facetable = true
+	case FieldGeo:
+		field.Filterable = true
+	}
+	return field
+}
+
+func checkField(field Field) error {
+	switch field.Type {
+	case FieldText, FieldKeyword, FieldInt, FieldFloat, FieldBool, FieldDate, FieldGeo, FieldVector:
+	default:
+		return fmt.Errorf("field %s has unknown type %s", field.Name, field.Type)
+	}
+	if field.Boost < 0 {
+		return fmt.Errorf("field %s has negative boost %s", field.Name, strconv.FormatFloat(field.Boost, 'g', -1, 64))
+	}
+	if field.Analyzer != "" && field.Type != FieldText {
+		return fmt.Errorf("field %s of type %s can not have an analyzer", field.Name, field.Type)
+	}
+	if field.Searchable && field.Type != FieldText && field.Type != FieldKeyword {
+		return fmt.Errorf("field %s of type %s can not be searchable", field.Name, field.Type)
+	}
+	if field.Suggest && !field.Searchable {
+		return fmt.Errorf("field %s must be searchable to be suggested", field.Name)
+	}
+	if field.Sortable && (field.Type == FieldGeo || field.Type == FieldVector) {
+		return fmt.Errorf("field %s of type %s can not be sortable", field.Name, field.Type)
+	}
+	if field.Facetable && (field.Type == FieldGeo || field.Type == FieldVector) {
+		return fmt.Errorf("field %s of type %s can not be facetable", field.Name, field.Type)
+	}
+	return nil
+}
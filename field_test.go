@@ -0,0 +1,116 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/infrago/base"
+)
+
+func TestParseFields(t *testing.T) {
+	schema, err := parseFields(Map{
+		"title":    Map{"type": "text", "boost": 3},
+		"body":     "text",
+		"category": " Keyword ",
+		"price":    Map{"type": "float", "sortable": "false"},
+		"secret":   Map{"type": "keyword", "stored": false},
+		"note":     Map{"type": "text", "searchable": false},
+		"":         "text",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(schema.Names(), ","); got != "body,category,note,price,secret,title" {
+		t.Fatalf("names %s", got)
+	}
+	title := schema["title"]
+	if !title.Searchable || !title.Suggest || title.Sortable || title.Boost != 3 {
+		t.Fatalf("title %+v", title)
+	}
+	if body := schema["body"]; !body.Suggest {
+		t.Fatalf("body %+v", body)
+	}
+	// a text field left out of search is left out of suggestions
+	if note := schema["note"]; note.Searchable || note.Suggest || !note.Stored {
+		t.Fatalf("note %+v", note)
+	}
+	if category := schema["category"]; category.Type != FieldKeyword || !category.Filterable || category.Searchable || category.Boost != 1 {
+		t.Fatalf("category %+v", category)
+	}
+	if price := schema["price"]; price.Sortable || !price.Filterable {
+		t.Fatalf("price %+v", price)
+	}
+	if schema["secret"].Stored {
+		t.Fatal("secret is stored")
+	}
+	if got := len(schema.Searchable()); got != 2 {
+		t.Fatalf("%d searchable fields, want 2", got)
+	}
+	if field, ok := schema.Lookup("title.sub.part"); !ok || field.Name != "title" {
+		t.Fatalf("lookup of a nested path %+v %v", field, ok)
+	}
+
+	errs := map[string]Map{
+		"unknown type":        {"x": "blob"},
+		"can not be sortable": {"x": Map{"type": "vector", "sortable": true}},
+		"negative boost":      {"x": Map{"type": "text", "boost": -1}},
+		"can not have an":     {"x": Map{"type": "int", "analyzer": "cjk"}},
+		"can not be search":   {"x": Map{"type": "int", "searchable": true}},
+		"to be suggested":     {"x": Map{"type": "text", "searchable": false, "suggest": true}},
+		"invalid filterable":  {"x": Map{"type": "text", "filterable": "maybe"}},
+		"invalid definition":  {"x": 5},
+	}
+	for want, cfg := range errs {
+		if _, err := parseFields(cfg); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseFields(%v) = %v, want %q", cfg, err, want)
+		}
+	}
+}
+
+func TestSchemaSearch(t *testing.T) {
+	c := newConn(t)
+	schema, err := parseFields(Map{
+		"title":    Map{"type": "text", "boost": 3},
+		"body":     "text",
+		"category": "keyword",
+		"price":    "float",
+		"secret":   Map{"type": "keyword", "stored": false},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SyncIndex("s", Index{Schema: schema, Primary: "id"})
+	c.Upsert("s", []Map{
+		{"id": "1", "title": "golang", "body": "rust", "category": "Tech", "secret": "x"},
+		{"id": "2", "title": "rust", "body": "golang id", "category": "life"},
+	})
+
+	// boosted fields rank first, unstored fields are not returned
+	res, _ := c.Search("s", BuildQuery("golang"))
+	if res.Total != 2 || res.Hits[0].ID != "1" {
+		t.Fatalf("boosted search ranked %v", res.Hits)
+	}
+	if _, ok := res.Hits[0].Payload["secret"]; ok {
+		t.Fatal("unstored field returned")
+	}
+	// keywords are searched as a whole, other declared fields not at all
+	if res, _ := c.Search("s", BuildQuery("tech")); res.Total != 0 {
+		t.Fatalf("keyword field searched by text %v", res.Hits)
+	}
+	if res, _ := c.Search("s", BuildQuery("", Map{"secret": "x"})); res.Total != 1 {
+		t.Fatalf("unstored field not filterable %v", res.Hits)
+	}
+	if _, err := c.Search("s", BuildQuery("", Map{"$sort": "title"})); err == nil {
+		t.Fatal("sorted by a text field")
+	}
+	if _, err := c.Search("s", BuildQuery("", Map{"title": "golang"})); err == nil {
+		t.Fatal("filtered by a text field")
+	}
+
+	// without schema the primary key is not searched
+	c = newConn(t)
+	c.Upsert("n", []Map{{"id": "1", "title": "abc"}})
+	if res, _ := c.Search("n", BuildQuery("1")); res.Total != 0 {
+		t.Fatalf("id searched %v", res.Hits)
+	}
+}
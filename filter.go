@@ -10,4 +10,49 @@ const (
 	FilterIn    = "in"
 	FilterNin   = "nin"
 	FilterRange = "range"
+
+	FilterExists   = "exists"
+	FilterMissing  = "missing"
+	FilterPrefix   = "prefix"
+	FilterContains = "contains"
+	FilterWildcard = "wildcard"
+	FilterRegex    = "regex"
+	// FilterText matches the analyzed terms of Value within a text field,
+	// in order when Value has several, a trailing * makes the last term a
+	// prefix.
+	FilterText = "text"
+
+	// logical filters combine Filter.Filters
+	FilterAnd = "and"
+	FilterOr  = "or"
+	FilterNor = "nor"
+	FilterNot = "not"
 )
+
+// isFieldOp reports whether op is a known field operator.
+func isFieldOp(op string) bool {
+	switch op {
+	case FilterEq, FilterNe, FilterGt, FilterGte, FilterLt, FilterLte,
+		FilterIn, FilterNin, FilterRange,
+		FilterExists, FilterMissing, FilterPrefix, FilterContains, FilterWildcard, FilterRegex, FilterText:
+		return true
+	}
+	return false
+}
+
+// isLogicalOp reports whether op combines child filters.
+func isLogicalOp(op string) bool {
+	switch op {
+	case FilterAnd, FilterOr, FilterNor, FilterNot:
+		return true
+	}
+	return false
+}
+
+// walkFilters calls fn for every filter of a tree, depth first.
+func walkFilters(filters []Filter, fn func(Filter)) {
+	for _, f := range filters {
+		fn(f)
+		walkFilters(f.Filters, fn)
+	}
+}
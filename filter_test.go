@@ -0,0 +1,156 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/infrago/base"
+)
+
+func TestFilterOperators(t *testing.T) {
+	c := newConn(t)
+	c.Upsert("f", []Map{
+		{"id": "1", "name": "Golang Book", "tag": nil},
+		{"id": "2", "name": "rust book", "tag": "x"},
+		{"id": "3", "name": "gopher"},
+	})
+	cases := []struct {
+		filter Map
+		total  int64
+	}{
+		{Map{"tag": Map{"$exists": true}}, 1},
+		{Map{"tag": Map{"$exists": false}}, 2},
+		{Map{"tag": Map{"$missing": true}}, 2},
+		{Map{"name": Map{"$prefix": "go"}}, 2},
+		{Map{"name": Map{"$contains": "BOOK"}}, 2},
+		{Map{"name": Map{"$wildcard": "go*r"}}, 1},
+		{Map{"name": Map{"$wildcard": "rust?book"}}, 1},
+		{Map{"name": Map{"$regex": "^[a-z]+ book$"}}, 1},
+	}
+	for _, one := range cases {
+		res, err := c.Search("f", BuildQuery("", one.filter))
+		if err != nil {
+			t.Fatalf("%v: %v", one.filter, err)
+		}
+		if res.Total != one.total {
+			t.Errorf("%v matched %d, want %d", one.filter, res.Total, one.total)
+		}
+	}
+}
+
+func TestFilterOperatorErrors(t *testing.T) {
+	c := newConn(t)
+	c.Upsert("f", []Map{{"id": "1", "name": "go"}})
+	if _, err := c.Search("f", BuildQuery("", Map{"name": Map{"$gtt": 1}})); err == nil {
+		t.Fatal("unknown operator accepted")
+	}
+	if _, err := c.Search("f", BuildQuery("", Map{"name": Map{"$regex": "("}})); err == nil {
+		t.Fatal("invalid regex accepted")
+	}
+	caps := Capabilities{FilterOps: []string{FilterEq}}
+	if err := checkCapabilities(caps, BuildQuery("", Map{"name": Map{"$prefix": "a"}})); err == nil {
+		t.Fatal("unsupported operator passed the capability check")
+	}
+}
+
+func TestFilterRegexpCache(t *testing.T) {
+	first, err := filterRegexp(FilterRegex, "^cached$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := filterRegexp(FilterRegex, "^cached$"); again != first {
+		t.Fatal("pattern compiled again while cached")
+	}
+	for i := range 2 * filterRegexpLimit {
+		filterRegexp(FilterWildcard, fmt.Sprintf("p%d*", i))
+	}
+	filterRegexps.mutex.Lock()
+	size := filterRegexps.order.Len()
+	filterRegexps.mutex.Unlock()
+	if size > filterRegexpLimit {
+		t.Fatalf("cache holds %d patterns, limit %d", size, filterRegexpLimit)
+	}
+	if again, _ := filterRegexp(FilterRegex, "^cached$"); again == first {
+		t.Fatal("least recently used pattern was not evicted")
+	}
+}
+
+func TestFilterTrees(t *testing.T) {
+	c := newConn(t)
+	c.Upsert("b", []Map{
+		{"id": "1", "category": "a", "featured": false},
+		{"id": "2", "category": "c", "featured": true},
+		{"id": "3", "category": "c", "featured": false},
+		{"id": "4", "category": "b", "price": 5},
+	})
+	cases := []struct {
+		filter Map
+		ids    string
+	}{
+		{Map{"$or": []Map{{"category": Map{"$in": []string{"a", "b"}}}, {"featured": true}}}, "124"},
+		{Map{"$and": []Map{{"category": "c"}, {"featured": false}}}, "3"},
+		{Map{"$not": Map{"category": "c"}}, "14"},
+		{Map{"$filters": Map{"$nor": []Any{Map{"category": "c"}, Map{"category": "a"}}}}, "4"},
+		{Map{"category": Map{"$not": Map{"$eq": "c"}}}, "14"},
+		// a $not list negates its conditions together
+		{Map{"$not": []Map{{"category": "c"}, {"featured": false}}}, "124"},
+		// trees nest and combine with the top level filters
+		{Map{"featured": false, "$or": []Map{{"category": "a"}, {"$and": []Map{{"category": "c"}, {"$not": Map{"price": 5}}}}}}, "13"},
+		{Map{"$or": []Map{{"price": Map{"$gt": 4}}, {"$nor": []Map{{"featured": true}, {"featured": false}}}}}, "4"},
+	}
+	for _, one := range cases {
+		res, err := c.Search("b", BuildQuery("", one.filter))
+		if err != nil {
+			t.Fatalf("%v: %v", one.filter, err)
+		}
+		if got := hitIDs(res.Hits); got != one.ids {
+			t.Errorf("%v matched %s, want %s", one.filter, got, one.ids)
+		}
+	}
+
+	for _, filter := range []Map{
+		{"$or": []Map{}},
+		{"$and": []Any{}},
+		{"$nor": []Map{{}}},
+		{"featured": false, "$or": []Map{{"category": "a"}, {"$or": []Map{}}}},
+	} {
+		if _, err := c.Search("b", BuildQuery("", filter)); err == nil || !strings.Contains(err.Error(), "no conditions") {
+			t.Errorf("%v: %v, want an empty group error", filter, err)
+		}
+	}
+
+	or := QuerySignature("b", BuildQuery("", Map{"$or": []Map{{"category": "a"}, {"category": "b"}}}))
+	and := QuerySignature("b", BuildQuery("", Map{"$and": []Map{{"category": "a"}, {"category": "b"}}}))
+	if or == and {
+		t.Fatal("signature ignores the filter tree")
+	}
+}
+
+func TestFilterMatchTree(t *testing.T) {
+	payload := Map{"n": 3, "tag": "y"}
+	eq := func(field string, value Any) Filter { return Filter{Field: field, Op: FilterEq, Value: value} }
+	cases := []struct {
+		filter Filter
+		match  bool
+	}{
+		{Filter{Op: FilterAnd, Filters: []Filter{eq("n", 3), eq("tag", "y")}}, true},
+		{Filter{Op: FilterAnd, Filters: []Filter{eq("n", 3), eq("tag", "z")}}, false},
+		{Filter{Op: FilterOr, Filters: []Filter{eq("n", 4), eq("tag", "y")}}, true},
+		{Filter{Op: FilterNor, Filters: []Filter{eq("n", 4), eq("tag", "z")}}, true},
+		{Filter{Op: FilterNot, Filters: []Filter{eq("n", 3)}}, false},
+		{Filter{Op: "OR", Filters: []Filter{{Op: FilterNot, Filters: []Filter{eq("n", 3)}}, eq("tag", "y")}}, true},
+		// NOT(AND(list))
+		{Filter{Op: FilterNot, Filters: []Filter{eq("n", 3), eq("tag", "z")}}, true},
+		{Filter{Op: FilterNot, Filters: []Filter{eq("n", 3), eq("tag", "y")}}, false},
+		// FilterMatch leaves empty groups to checkFilters, they do not filter
+		{Filter{Op: FilterAnd}, true},
+		{Filter{Op: FilterOr}, true},
+		{Filter{Op: FilterNot}, true},
+	}
+	for _, one := range cases {
+		if got := FilterMatch(one.filter, payload); got != one.match {
+			t.Errorf("FilterMatch(%+v) = %v, want %v", one.filter, got, one.match)
+		}
+	}
+}
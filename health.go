@@ -0,0 +1,217 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// health check defaults, see Config.
+const (
+	DefaultHealthInterval     = 10 * time.Second
+	DefaultUnhealthyThreshold = 3
+	DefaultHealthyThreshold   = 2
+)
+
+// InstanceHealth is the state of an instance as seen by the health
+// checker and by failed reads.
+type InstanceHealth struct {
+	Instance     string    `json:"instance"`
+	Driver       string    `json:"driver"`
+	Healthy      bool      `json:"healthy"`
+	Checked      bool      `json:"checked"`
+	Failures     int       `json:"failures"`
+	ReadFailures int       `json:"read_failures"`
+	Error        string    `json:"error,omitempty"`
+	CheckedAt    time.Time `json:"checked_at,omitzero"`
+}
+
+// instanceHealth is the checker state of an instance, the flag the
+// checker sets is Instance.down. Failed reads are counted apart.
+type instanceHealth struct {
+	mutex     sync.Mutex
+	failures  int
+	successes int
+	err       error
+	checked   time.Time
+
+	reads    int
+	readFail time.Time
+
+	// pinging is set while a ping runs, a ping that does not return is
+	// not started again.
+	pinging atomic.Bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Health reports every instance, for readiness endpoints.
+func (m *Module) Health() map[string]InstanceHealth {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	out := make(map[string]InstanceHealth, len(m.instances))
+	for name, inst := range m.instances {
+		h := &inst.health
+		h.mutex.Lock()
+		one := InstanceHealth{
+			Instance:     name,
+			Driver:       inst.Config.Driver,
+			Checked:      !h.checked.IsZero(),
+			Failures:     h.failures,
+			ReadFailures: h.reads,
+			CheckedAt:    h.checked,
+		}
+		if h.err != nil {
+			one.Error = h.err.Error()
+		}
+		h.mutex.Unlock()
+		one.Healthy = inst.healthy()
+		out[name] = one
+	}
+	return out
+}
+
+// startHealthLocked starts a checker for every instance whose connection
+// implements Pinger.
+func (m *Module) startHealthLocked() {
+	for _, inst := range m.instances {
+		pinger, ok := inst.conn.(Pinger)
+		if !ok {
+			continue
+		}
+		interval := inst.Config.HealthInterval
+		if interval <= 0 {
+			interval = DefaultHealthInterval
+		}
+		stop, done := make(chan struct{}), make(chan struct{})
+		inst.health.mutex.Lock()
+		inst.health.stop, inst.health.done = stop, done
+		inst.health.mutex.Unlock()
+		go m.healthLoop(inst, pinger, interval, stop, done)
+	}
+}
+
+// stopHealth stops the checkers, it must not be called with m.mutex held
+// as a check may be waiting for it.
+func (m *Module) stopHealth() {
+	m.mutex.RLock()
+	insts := make([]*Instance, 0, len(m.instances))
+	for _, inst := range m.instances {
+		insts = append(insts, inst)
+	}
+	m.mutex.RUnlock()
+	for _, inst := range insts {
+		h := &inst.health
+		h.mutex.Lock()
+		stop, done := h.stop, h.done
+		h.stop, h.done = nil, nil
+		h.mutex.Unlock()
+		if stop != nil {
+			close(stop)
+			<-done
+		}
+	}
+}
+
+func (m *Module) healthLoop(inst *Instance, pinger Pinger, interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.check(inst, pinger, interval)
+		}
+	}
+}
+
+// check pings an instance and records the result. While a ping that timed
+// out has not returned, checks fail without pinging again.
+func (m *Module) check(inst *Instance, pinger Pinger, interval time.Duration) {
+	timeout := inst.Config.Timeout
+	if timeout <= 0 || timeout > interval {
+		timeout = interval
+	}
+	var err error
+	if inst.health.pinging.CompareAndSwap(false, true) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		_, err = await(ctx, func() (struct{}, error) {
+			defer inst.health.pinging.Store(false)
+			return struct{}{}, pinger.Ping()
+		})
+		cancel()
+	} else {
+		err = fmt.Errorf("search instance %s: previous ping has not returned", inst.Name)
+	}
+	inst.record(err)
+}
+
+// healthy reports whether reads should try the instance before the
+// others: it is not down and did not fail unhealthy_threshold reads in a
+// row within the last health interval. Read failures expire so that an
+// instance without Pinger is tried again.
+func (inst *Instance) healthy() bool {
+	if inst.down.Load() {
+		return false
+	}
+	unhealthy, interval := inst.Config.UnhealthyThreshold, inst.Config.HealthInterval
+	if unhealthy <= 0 {
+		unhealthy = DefaultUnhealthyThreshold
+	}
+	if interval <= 0 {
+		interval = DefaultHealthInterval
+	}
+	h := &inst.health
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.reads < unhealthy || time.Since(h.readFail) >= interval
+}
+
+// recordRead counts a read that failed with a transient error, or resets
+// the count once a read succeeds.
+func (inst *Instance) recordRead(err error) {
+	h := &inst.health
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if err != nil {
+		h.reads++
+		h.readFail = time.Now()
+		return
+	}
+	h.reads = 0
+}
+
+// record counts a ping and flips the instance state once a threshold
+// of consecutive failures or successes is reached.
+func (inst *Instance) record(err error) {
+	unhealthy, healthy := inst.Config.UnhealthyThreshold, inst.Config.HealthyThreshold
+	if unhealthy <= 0 {
+		unhealthy = DefaultUnhealthyThreshold
+	}
+	if healthy <= 0 {
+		healthy = DefaultHealthyThreshold
+	}
+
+	h := &inst.health
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.checked, h.err = time.Now(), err
+	if err != nil {
+		h.failures++
+		h.successes = 0
+		if h.failures >= unhealthy {
+			inst.down.Store(true)
+		}
+		return
+	}
+	h.successes++
+	h.failures = 0
+	if h.successes >= healthy {
+		inst.down.Store(false)
+	}
+}
@@ -0,0 +1,112 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/infrago/util"
+)
+
+// flakyConn fails its pings while fail is set, and blocks them while
+// block is open.
+type flakyConn struct {
+	Connection
+	fail  *atomic.Bool
+	block chan struct{}
+	pings *atomic.Int32
+}
+
+func (f flakyConn) Ping() error {
+	if f.pings != nil {
+		f.pings.Add(1)
+	}
+	if f.block != nil {
+		<-f.block
+	}
+	if f.fail != nil && f.fail.Load() {
+		return errors.New("unreachable")
+	}
+	return nil
+}
+
+func healthModule(t *testing.T, conn flakyConn) *Module {
+	cfg := Config{HealthInterval: 5 * time.Millisecond, UnhealthyThreshold: 2, HealthyThreshold: 1}
+	m := &Module{
+		instances: map[string]*Instance{
+			"a": {Name: "a", conn: newConn(t)},
+			"b": {Name: "b", Config: cfg, conn: conn},
+		},
+		weights: map[string]int{"a": 1, "b": 1},
+		indexes: map[string]Index{},
+	}
+	m.hashring = util.NewHashRing(m.weights)
+	m.startHealthLocked()
+	t.Cleanup(m.stopHealth)
+	return m
+}
+
+func TestHealthFailover(t *testing.T) {
+	fail := &atomic.Bool{}
+	fail.Store(true)
+	m := healthModule(t, flakyConn{Connection: newConn(t), fail: fail})
+	m.RegisterIndex("docs", Index{Replicas: 2})
+	placed := map[string]string{}
+	for i := range 20 {
+		placed[fmt.Sprint(i)] = m.pickInst(fmt.Sprint(i)).Name
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	health := m.Health()
+	if health["b"].Healthy || health["b"].Error == "" || !health["a"].Healthy {
+		t.Fatalf("health %+v", health)
+	}
+	// replicated indexes read from the healthy replica, the others stay
+	// where they are rather than move their writes elsewhere
+	if inst := m.pickInst("docs"); inst.Name != "a" {
+		t.Fatalf("replicated index picked %s", inst.Name)
+	}
+	for key, name := range placed {
+		if inst := m.pickInst(key); inst.Name != name {
+			t.Fatalf("index %s moved from %s to %s", key, name, inst.Name)
+		}
+	}
+
+	fail.Store(false)
+	time.Sleep(30 * time.Millisecond)
+	if !m.Health()["b"].Healthy {
+		t.Fatal("instance did not recover")
+	}
+}
+
+func TestHealthHangingPing(t *testing.T) {
+	block, pings := make(chan struct{}), &atomic.Int32{}
+	m := healthModule(t, flakyConn{Connection: newConn(t), block: block, pings: pings})
+	time.Sleep(60 * time.Millisecond)
+	if n := pings.Load(); n != 1 {
+		t.Fatalf("%d pings started while the first one hangs, want 1", n)
+	}
+	if m.Health()["b"].Healthy {
+		t.Fatal("instance with a hanging ping is healthy")
+	}
+
+	close(block)
+	time.Sleep(30 * time.Millisecond)
+	if pings.Load() < 2 || !m.Health()["b"].Healthy {
+		t.Fatal("instance did not recover once its ping returned")
+	}
+}
+
+func TestHealthRestart(t *testing.T) {
+	m := healthModule(t, flakyConn{Connection: newConn(t)})
+	for range 3 {
+		m.stopHealth()
+		m.mutex.Lock()
+		m.startHealthLocked()
+		m.mutex.Unlock()
+	}
+	m.stopHealth()
+	m.stopHealth()
+}
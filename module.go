@@ -1,10 +1,13 @@
 package search
 
 import (
+	"context"
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/infrago/infra"
@@ -22,6 +25,8 @@ var module = &Module{
 	instances: make(map[string]*Instance),
 	weights:   make(map[string]int),
 	indexes:   make(map[string]Index),
+	analyzers: make(map[string]Analyzer),
+	retries:   make(map[string]RetryPolicy),
 }
 
 type (
@@ -31,6 +36,12 @@ type (
 		Prefix  string
 		Timeout time.Duration
 		Setting Map
+
+		// HealthInterval, UnhealthyThreshold and HealthyThreshold tune the
+		// health checker of connections implementing Pinger.
+		HealthInterval     time.Duration
+		UnhealthyThreshold int
+		HealthyThreshold   int
 	}
 
 	Configs map[string]Config
@@ -40,6 +51,9 @@ type (
 		Config  Config
 		Setting Map
 		conn    Connection
+		down    atomic.Bool
+		health  instanceHealth
+		breaker breaker
 	}
 
 	Module struct {
@@ -53,6 +67,13 @@ type (
 		weights   map[string]int
 		indexes   map[string]Index
 		hashring  *util.HashRing
+
+		analyzerMutex sync.RWMutex
+		analyzers     map[string]Analyzer
+
+		policyMutex sync.RWMutex
+		retries     map[string]RetryPolicy
+		circuit     *BreakerPolicy
 	}
 )
 
@@ -68,6 +89,14 @@ func (m *Module) Register(name string, value Any) {
 		m.RegisterIndex(name, v)
 	case Indexes:
 		m.RegisterIndexes(v)
+	case Analyzer:
+		m.RegisterAnalyzer(name, v)
+	case Analyzers:
+		m.RegisterAnalyzers(v)
+	case RetryPolicy:
+		m.RegisterRetryPolicy(name, v)
+	case BreakerPolicy:
+		m.RegisterBreakerPolicy(v)
 	}
 }
 
@@ -119,6 +148,39 @@ func (m *Module) RegisterIndex(name string, index Index) {
 	if index.Primary == "" {
 		index.Primary = "id"
 	}
+	schema, err := parseFields(index.Fields)
+	if err != nil {
+		panic("invalid search index " + name + ": " + err.Error())
+	}
+	for fname, field := range index.Schema {
+		if _, ok := schema[fname]; !ok {
+			field.Name = fname
+			if err := checkField(field); err != nil {
+				panic("invalid search index " + name + ": " + err.Error())
+			}
+			if field.Boost == 0 {
+				field.Boost = 1
+			}
+			schema[fname] = field
+		}
+	}
+	index.Schema = schema
+	instances := make([]string, 0, len(index.Instances))
+	for _, one := range index.Instances {
+		if one = strings.TrimSpace(one); one != "" && !slices.Contains(instances, one) {
+			instances = append(instances, one)
+		}
+	}
+	index.Instances = instances
+	for _, synonym := range index.Synonyms {
+		if err := checkSynonym(synonym); err != nil {
+			panic("invalid search index " + name + ": " + err.Error())
+		}
+	}
+	index.Consistency = strings.ToLower(strings.TrimSpace(index.Consistency))
+	if err := checkConsistency(index.Consistency); err != nil {
+		panic("invalid search index " + name + ": " + err.Error())
+	}
 	if infra.Override() {
 		m.indexes[name] = index
 	} else if _, ok := m.indexes[name]; !ok {
@@ -159,13 +221,18 @@ func (m *Module) Config(global Map) {
 	if v, ok := cfgMap["setting"].(Map); ok {
 		defaults.Setting = v
 	}
+	configHealth(&defaults, cfgMap)
+	m.configRetry(cfgMap)
 
-	if defaults.Driver != "" || defaults.Weight != 0 || defaults.Prefix != "" || defaults.Timeout > 0 || defaults.Setting != nil {
+	if defaults.Driver != "" || defaults.Weight != 0 || defaults.Prefix != "" || defaults.Timeout > 0 || defaults.Setting != nil ||
+		defaults.HealthInterval > 0 || defaults.UnhealthyThreshold > 0 || defaults.HealthyThreshold > 0 {
 		m.RegisterConfig(infra.DEFAULT, defaults)
 	}
 
 	for name, vv := range cfgMap {
-		if name == "driver" || name == "weight" || name == "prefix" || name == "timeout" || name == "setting" {
+		if name == "driver" || name == "weight" || name == "prefix" || name == "timeout" || name == "setting" ||
+			name == "health_interval" || name == "unhealthy_threshold" || name == "healthy_threshold" ||
+			name == "retry" || name == "breaker" {
 			continue
 		}
 		one, ok := vv.(Map)
@@ -188,10 +255,23 @@ func (m *Module) Config(global Map) {
 		if v, ok := one["setting"].(Map); ok {
 			cfg.Setting = v
 		}
+		configHealth(&cfg, one)
 		m.RegisterConfig(name, cfg)
 	}
 }
 
+func configHealth(cfg *Config, one Map) {
+	if v, ok := one["health_interval"]; ok {
+		cfg.HealthInterval = parseDuration(v)
+	}
+	if v, ok := toInt(one["unhealthy_threshold"]); ok {
+		cfg.UnhealthyThreshold = v
+	}
+	if v, ok := toInt(one["healthy_threshold"]); ok {
+		cfg.HealthyThreshold = v
+	}
+}
+
 func (m *Module) Setup() {}
 
 func (m *Module) Open() {
@@ -237,17 +317,35 @@ func (m *Module) Open() {
 		m.weights[name] = cfg.Weight
 	}
 
+	// placement stays on every configured instance whatever their health,
+	// reads skip the unhealthy replicas instead
 	m.hashring = util.NewHashRing(m.weights)
 
+	if err := m.checkAnalyzersLocked(); err != nil {
+		panic(err.Error())
+	}
+
+	for name, index := range m.indexes {
+		for _, one := range index.Instances {
+			if _, ok := m.instances[one]; !ok {
+				panic("search index " + name + " is routed to missing instance " + one)
+			}
+		}
+	}
+
 	for name, index := range m.indexes {
-		conn := m.pickConnLocked(name)
-		if conn == nil {
+		insts := m.replicasLocked(name)
+		if len(insts) == 0 {
 			continue
 		}
-		if err := conn.SyncIndex(name, index); err != nil {
+		err := m.writeReplicas(context.Background(), insts, index.Consistency, "sync", name, func(ctx context.Context, inst *Instance) error {
+			return inst.conn.SyncIndex(inst.physical(name), inst.physicalIndex(index))
+		})
+		if err != nil {
 			panic("create search index failed: " + err.Error())
 		}
 	}
+	m.startHealthLocked()
 	m.opened = true
 }
 
@@ -258,6 +356,8 @@ func (m *Module) Start() {
 func (m *Module) Stop() {}
 
 func (m *Module) Close() {
+	m.stopHealth()
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -279,35 +379,93 @@ func (m *Module) pickConn(key string) Connection {
 }
 
 func (m *Module) pickConnLocked(key string) Connection {
+	if inst := m.pickInstLocked(key); inst != nil {
+		return inst.conn
+	}
+	return nil
+}
+
+func (m *Module) pickInst(key string) *Instance {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.pickInstLocked(key)
+}
+
+// physical is the name of an index in the instance backend, the logical
+// name with Config.Prefix in front. Routing and Index lookups use the
+// logical name.
+func (inst *Instance) physical(index string) string {
+	return inst.Config.Prefix + index
+}
+
+func (inst *Instance) physicalIndex(index Index) Index {
+	index.Name = inst.physical(index.Name)
+	return index
+}
+
+// pickInstLocked is the first healthy replica of an index.
+func (m *Module) pickInstLocked(key string) *Instance {
+	insts := m.replicasLocked(key)
+	for _, inst := range insts {
+		if inst.healthy() {
+			return inst
+		}
+	}
+	if len(insts) > 0 {
+		return insts[0]
+	}
+	return nil
+}
+
+// routeLocked is the instances an index is routed to by Index.Instances,
+// nil when it is not routed.
+func (m *Module) routeLocked(index string) []*Instance {
+	def, ok := m.indexes[index]
+	if !ok || len(def.Instances) == 0 {
+		return nil
+	}
+	out := make([]*Instance, 0, len(def.Instances))
+	for _, name := range def.Instances {
+		if inst, ok := m.instances[name]; ok {
+			out = append(out, inst)
+		}
+	}
+	return out
+}
+
+// locateLocked picks an instance for an unrouted key on the hash ring.
+func (m *Module) locateLocked(key string) *Instance {
 	if len(m.instances) == 0 {
 		return nil
 	}
 	if m.hashring == nil {
 		for _, inst := range m.instances {
-			return inst.conn
+			return inst
 		}
 		return nil
 	}
 	name := m.hashring.Locate(key)
 	if inst, ok := m.instances[name]; ok {
-		return inst.conn
+		return inst
 	}
 	for _, inst := range m.instances {
-		return inst.conn
+		return inst
 	}
 	return nil
 }
 
 func (m *Module) Clear(index string) error {
+	return m.ClearContext(context.Background(), index)
+}
+
+func (m *Module) ClearContext(ctx context.Context, index string) error {
 	index = strings.TrimSpace(index)
 	if index == "" {
 		return fmt.Errorf("search index is empty")
 	}
-	conn := m.pickConn(index)
-	if conn == nil {
-		return fmt.Errorf("search is not ready")
-	}
-	return conn.Clear(index)
+	return m.write(ctx, "clear", index, func(ctx context.Context, inst *Instance) error {
+		return connClear(ctx, inst.conn, inst.physical(index))
+	})
 }
 
 func (m *Module) Capabilities(index string) Capabilities {
@@ -331,33 +489,66 @@ func (m *Module) ListCapabilities() map[string]Capabilities {
 	return out
 }
 
-func (m *Module) Upsert(index string, rows ...Map) error {
-	conn := m.pickConn(index)
-	if conn == nil {
-		return fmt.Errorf("search is not ready")
+// ListIndexes reports the instances serving each registered index.
+func (m *Module) ListIndexes() map[string][]string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	out := make(map[string][]string, len(m.indexes))
+	for name := range m.indexes {
+		names := make([]string, 0, 1)
+		for _, inst := range m.replicasLocked(name) {
+			names = append(names, inst.Name)
+		}
+		out[name] = names
 	}
+	return out
+}
+
+func (m *Module) Upsert(index string, rows ...Map) error {
+	return m.UpsertContext(context.Background(), index, rows...)
+}
+
+func (m *Module) UpsertContext(ctx context.Context, index string, rows ...Map) error {
 	rows, err := m.prepareRows(index, rows)
 	if err != nil {
 		return err
 	}
-	return conn.Upsert(index, rows)
+	return m.write(ctx, "upsert", index, func(ctx context.Context, inst *Instance) error {
+		return connUpsert(ctx, inst.conn, inst.physical(index), rows)
+	})
 }
 
 func (m *Module) Delete(index string, ids []string) error {
-	conn := m.pickConn(index)
-	if conn == nil {
-		return fmt.Errorf("search is not ready")
-	}
-	return conn.Delete(index, ids)
+	return m.DeleteContext(context.Background(), index, ids)
+}
+
+func (m *Module) DeleteContext(ctx context.Context, index string, ids []string) error {
+	return m.write(ctx, "delete", index, func(ctx context.Context, inst *Instance) error {
+		return connDelete(ctx, inst.conn, inst.physical(index), ids)
+	})
 }
 
 func (m *Module) Search(index, keyword string, args ...Any) (Result, error) {
-	conn := m.pickConn(index)
-	if conn == nil {
+	return m.SearchContext(context.Background(), index, keyword, args...)
+}
+
+func (m *Module) SearchContext(ctx context.Context, index, keyword string, args ...Any) (Result, error) {
+	inst := m.pickInst(index)
+	if inst == nil {
 		return Result{}, fmt.Errorf("search is not ready")
 	}
-	query := BuildQuery(keyword, args...)
-	res, err := conn.Search(index, query)
+	query, err := m.buildQuery(index, keyword, args...)
+	if err != nil {
+		return Result{}, err
+	}
+	if err := checkCapabilities(inst.conn.Capabilities(), query); err != nil {
+		return Result{}, err
+	}
+	var res Result
+	err = m.read(ctx, "search", index, func(ctx context.Context, inst *Instance) error {
+		res, err = connSearch(ctx, inst.conn, inst.physical(index), query)
+		return err
+	})
 	if err != nil {
 		return res, err
 	}
@@ -365,12 +556,123 @@ func (m *Module) Search(index, keyword string, args ...Any) (Result, error) {
 }
 
 func (m *Module) Count(index, keyword string, args ...Any) (int64, error) {
-	conn := m.pickConn(index)
-	if conn == nil {
+	return m.CountContext(context.Background(), index, keyword, args...)
+}
+
+func (m *Module) CountContext(ctx context.Context, index, keyword string, args ...Any) (int64, error) {
+	inst := m.pickInst(index)
+	if inst == nil {
 		return 0, fmt.Errorf("search is not ready")
 	}
-	query := BuildQuery(keyword, args...)
-	return conn.Count(index, query)
+	query, err := m.buildQuery(index, keyword, args...)
+	if err != nil {
+		return 0, err
+	}
+	query.Cursor, query.Scroll = "", 0
+	if err := checkCapabilities(inst.conn.Capabilities(), query); err != nil {
+		return 0, err
+	}
+	var count int64
+	err = m.read(ctx, "count", index, func(ctx context.Context, inst *Instance) error {
+		count, err = connCount(ctx, inst.conn, inst.physical(index), query)
+		return err
+	})
+	return count, err
+}
+
+func (m *Module) Suggest(index, prefix string, args ...Any) ([]Suggestion, error) {
+	return m.SuggestContext(context.Background(), index, prefix, args...)
+}
+
+func (m *Module) SuggestContext(ctx context.Context, index, prefix string, args ...Any) ([]Suggestion, error) {
+	inst := m.pickInst(index)
+	if inst == nil {
+		return nil, fmt.Errorf("search is not ready")
+	}
+	if _, ok := inst.conn.(Suggester); !ok || !inst.conn.Capabilities().Suggest {
+		return nil, fmt.Errorf("search driver does not support suggest")
+	}
+	query := BuildSuggestQuery(prefix, args...)
+	var out []Suggestion
+	err := m.read(ctx, "suggest", index, func(ctx context.Context, inst *Instance) error {
+		suggester, ok := inst.conn.(Suggester)
+		if !ok {
+			return fmt.Errorf("search driver does not support suggest")
+		}
+		var err error
+		out, err = await(ctx, func() ([]Suggestion, error) {
+			return suggester.Suggest(inst.physical(index), query)
+		})
+		return err
+	})
+	return out, err
+}
+
+// checkCapabilities rejects invalid filters and query features the
+// connection does not support.
+func checkCapabilities(caps Capabilities, query Query) error {
+	if err := checkFilters(query.Filters); err != nil {
+		return err
+	}
+	if len(caps.FilterOps) > 0 {
+		ops := make(map[string]struct{}, len(caps.FilterOps))
+		for _, op := range caps.FilterOps {
+			ops[normalizeFilterOp(op)] = struct{}{}
+		}
+		var err error
+		walkFilters(query.Filters, func(f Filter) {
+			op := normalizeFilterOp(f.Op)
+			if op == "" {
+				op = FilterEq
+			}
+			if _, ok := ops[op]; err == nil && !ok && !isLogicalOp(op) {
+				err = fmt.Errorf("search driver does not support filter operator %s", op)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(query.SearchFields) > 0 && !caps.SearchFields {
+		return fmt.Errorf("search driver does not support field restricted search")
+	}
+	if (len(query.Required) > 0 || len(query.Excluded) > 0 || len(query.Should) > 0) && !caps.TermClauses {
+		return fmt.Errorf("search driver does not support required, excluded or optional terms")
+	}
+	if len(query.Phrases) > 0 && !caps.Phrases {
+		return fmt.Errorf("search driver does not support phrase search")
+	}
+	if query.Fuzzy.Distance != 0 && !caps.Fuzzy {
+		return fmt.Errorf("search driver does not support fuzzy search")
+	}
+	if query.Scroll > 0 && !caps.Scroll {
+		return fmt.Errorf("search driver does not support scroll")
+	}
+	if query.Cursor != "" {
+		cursor, err := DecodeCursor(query.Cursor)
+		if err != nil {
+			return err
+		}
+		if cursor.Scroll != "" && !caps.Scroll {
+			return fmt.Errorf("search driver does not support scroll")
+		}
+		if cursor.Scroll == "" && !caps.Cursor {
+			return fmt.Errorf("search driver does not support cursor paging")
+		}
+	}
+	if len(query.RangeFacets) > 0 && !caps.RangeFacets {
+		return fmt.Errorf("search driver does not support range facets")
+	}
+	if !caps.BoolFilters {
+		logical := false
+		walkFilters(query.Filters, func(f Filter) {
+			logical = logical || isLogicalOp(normalizeFilterOp(f.Op))
+		})
+		if logical {
+			return fmt.Errorf("search driver does not support boolean filters")
+		}
+	}
+	return nil
 }
 
 func (m *Module) prepareRows(index string, rows []Map) ([]Map, error) {
@@ -0,0 +1,102 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/util"
+)
+
+func TestPrefix(t *testing.T) {
+	inst := &Instance{Name: "a", Config: Config{Prefix: "staging_"}}
+	conn, err := (&defaultDriver{}).Connect(inst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := conn.(*defaultConnection)
+	inst.conn = c
+	m := &Module{instances: map[string]*Instance{"a": inst}, indexes: map[string]Index{}}
+	m.RegisterIndex("docs", Index{Fields: Map{"title": "text"}})
+	if err := c.SyncIndex(inst.physical("docs"), inst.physicalIndex(m.indexes["docs"])); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Upsert("docs", Map{"id": "1", "title": "hello"}, Map{"id": "2", "title": "help"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.indexes["staging_docs"]; !ok || len(c.indexes) != 1 {
+		t.Fatalf("physical indexes %v, want staging_docs only", c.indexes)
+	}
+	if res, err := m.Search("docs", "hello"); err != nil || res.Total != 1 {
+		t.Fatalf("search %+v %v", res, err)
+	}
+	if n, err := m.Count("docs", ""); err != nil || n != 2 {
+		t.Fatalf("count %d %v", n, err)
+	}
+	// errors name the index as the caller knows it
+	_, err = m.Search("docs", "", Map{"$sort": "title"})
+	if err == nil || !strings.Contains(err.Error(), "index docs ") {
+		t.Fatalf("sort on a text field: %v, want the logical index name", err)
+	}
+	if out, err := m.Suggest("docs", "hel"); err != nil || len(out) != 2 {
+		t.Fatalf("suggest %v %v", out, err)
+	}
+	n := 0
+	for _, err := range m.Scan("docs", "") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("scan yielded %d hits", n)
+	}
+
+	if err := m.Delete("docs", []string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := docIDs(c, "staging_docs"); got != "2" {
+		t.Fatalf("after delete %q, want 2", got)
+	}
+	if err := m.Clear("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if got := docIDs(c, "staging_docs"); got != "" {
+		t.Fatalf("after clear %q", got)
+	}
+	if _, ok := c.indexes["docs"]; ok {
+		t.Fatal("an index was created without the prefix")
+	}
+}
+
+func TestRouting(t *testing.T) {
+	a, b := newConn(t), newConn(t)
+	weights := map[string]int{"a": 1, "b": 1}
+	m := &Module{
+		instances: map[string]*Instance{"a": {Name: "a", conn: a}, "b": {Name: "b", conn: b}},
+		weights:   weights,
+		hashring:  util.NewHashRing(weights),
+		indexes:   map[string]Index{},
+	}
+	m.RegisterIndex("orders", Index{Instances: []string{" b ", "b", ""}})
+	m.RegisterIndex("logs", Index{})
+	for i := range 5 {
+		m.Upsert("orders", Map{"id": fmt.Sprint(i)})
+	}
+	if len(a.indexes) != 0 || len(b.indexes["orders"].docs) != 5 {
+		t.Fatalf("routed writes reached a: %v, b: %q", a.indexes, docIDs(b, "orders"))
+	}
+	if res, err := m.Search("orders", ""); err != nil || res.Total != 5 {
+		t.Fatalf("routed search %+v %v", res, err)
+	}
+
+	indexes := m.ListIndexes()
+	if got := indexes["orders"]; len(got) != 1 || got[0] != "b" {
+		t.Fatalf("orders listed on %v, want b", got)
+	}
+	// unrouted indexes stay on the hash ring
+	if got := indexes["logs"]; len(got) != 1 || got[0] != m.hashring.Locate("logs") {
+		t.Fatalf("logs listed on %v, want the hash ring choice", got)
+	}
+}
@@ -0,0 +1,284 @@
+package search
+
+import (
+	"strings"
+
+	. "github.com/infrago/base"
+)
+
+// resolvePath returns every value found at a dotted path such as
+// "author.name". Arrays along the way fan out, so "tags" or "authors.name"
+// yield one value per element. A literal key containing dots wins over
+// the nested lookup.
+func resolvePath(payload Map, path string) ([]Any, bool) {
+	if payload == nil {
+		return nil, false
+	}
+	if v, ok := payload[path]; ok {
+		return flattenValues(v, nil), true
+	}
+	out := make([]Any, 0, 1)
+	found := false
+	resolveParts(payload, strings.Split(path, "."), func(v Any) {
+		found = true
+		out = flattenValues(v, out)
+	})
+	return out, found
+}
+
+func resolveParts(v Any, parts []string, fn func(Any)) {
+	if len(parts) == 0 {
+		fn(v)
+		return
+	}
+	switch vv := v.(type) {
+	case Map:
+		if child, ok := vv[parts[0]]; ok {
+			resolveParts(child, parts[1:], fn)
+		}
+	case []Map:
+		for _, one := range vv {
+			resolveParts(one, parts, fn)
+		}
+	case []Any:
+		for _, one := range vv {
+			resolveParts(one, parts, fn)
+		}
+	}
+}
+
+// flattenValues appends v to out, expanding arrays into their elements.
+func flattenValues(v Any, out []Any) []Any {
+	switch vv := v.(type) {
+	case []Any:
+		for _, one := range vv {
+			out = flattenValues(one, out)
+		}
+	case []Map:
+		for _, one := range vv {
+			out = append(out, one)
+		}
+	case []string:
+		for _, one := range vv {
+			out = append(out, one)
+		}
+	case []int:
+		for _, one := range vv {
+			out = append(out, one)
+		}
+	case []int64:
+		for _, one := range vv {
+			out = append(out, one)
+		}
+	case []float64:
+		for _, one := range vv {
+			out = append(out, one)
+		}
+	default:
+		out = append(out, v)
+	}
+	return out
+}
+
+// pathValue returns the value used to sort by a path, the smallest one
+// for ascending and the largest one for descending sorts when the path
+// holds several values.
+func pathValue(payload Map, path string, desc bool) Any {
+	values, _ := resolvePath(payload, path)
+	if len(values) == 0 {
+		return nil
+	}
+	best := values[0]
+	for _, one := range values[1:] {
+		cmp := compareForSort(one, best)
+		if (desc && cmp > 0) || (!desc && cmp < 0) {
+			best = one
+		}
+	}
+	return best
+}
+
+// pickPath copies the part of payload selected by a dotted path, keeping
+// the nesting, arrays are mapped element by element.
+func pickPath(payload Map, path string) (Map, bool) {
+	if v, ok := payload[path]; ok {
+		return Map{path: v}, true
+	}
+	v, ok := pickParts(payload, strings.Split(path, "."))
+	if !ok {
+		return nil, false
+	}
+	m, ok := v.(Map)
+	return m, ok
+}
+
+func pickParts(v Any, parts []string) (Any, bool) {
+	if len(parts) == 0 {
+		return v, true
+	}
+	switch vv := v.(type) {
+	case Map:
+		child, ok := vv[parts[0]]
+		if !ok {
+			return nil, false
+		}
+		picked, ok := pickParts(child, parts[1:])
+		if !ok {
+			return nil, false
+		}
+		return Map{parts[0]: picked}, true
+	case []Map:
+		out := make([]Any, 0, len(vv))
+		for _, one := range vv {
+			if picked, ok := pickParts(one, parts); ok {
+				out = append(out, picked)
+			}
+		}
+		return out, len(out) > 0
+	case []Any:
+		out := make([]Any, 0, len(vv))
+		for _, one := range vv {
+			if picked, ok := pickParts(one, parts); ok {
+				out = append(out, picked)
+			}
+		}
+		return out, len(out) > 0
+	}
+	return nil, false
+}
+
+// mergePicked merges two results of pickPath without touching the values
+// shared with the payload.
+func mergePicked(dst, src Any) Any {
+	switch sv := src.(type) {
+	case Map:
+		dv, ok := dst.(Map)
+		if !ok {
+			return sv
+		}
+		dv = cloneMap(dv)
+		for k, v := range sv {
+			if old, ok := dv[k]; ok {
+				dv[k] = mergePicked(old, v)
+			} else {
+				dv[k] = v
+			}
+		}
+		return dv
+	case []Any:
+		dv, ok := dst.([]Any)
+		if !ok || len(dv) != len(sv) {
+			return sv
+		}
+		dv = append([]Any{}, dv...)
+		for i := range sv {
+			dv[i] = mergePicked(dv[i], sv[i])
+		}
+		return dv
+	}
+	return src
+}
+
+// rewritePath returns a copy of payload where every leaf value at path is
+// replaced by fn, untouched branches are shared with the original.
+func rewritePath(payload Map, path string, fn func(Any) (Any, bool)) (Map, bool) {
+	parts := strings.Split(path, ".")
+	if _, ok := payload[path]; ok {
+		parts = []string{path}
+	}
+	v, ok := rewriteParts(payload, parts, fn)
+	if !ok {
+		return payload, false
+	}
+	return v.(Map), true
+}
+
+func rewriteParts(v Any, parts []string, fn func(Any) (Any, bool)) (Any, bool) {
+	switch vv := v.(type) {
+	case Map:
+		if len(parts) == 0 {
+			return fn(v)
+		}
+		child, ok := vv[parts[0]]
+		if !ok {
+			return v, false
+		}
+		nv, changed := rewriteParts(child, parts[1:], fn)
+		if !changed {
+			return v, false
+		}
+		out := cloneMap(vv)
+		out[parts[0]] = nv
+		return out, true
+	case []Map:
+		out := make([]Any, len(vv))
+		changed := false
+		for i, one := range vv {
+			nv, ok := rewriteParts(one, parts, fn)
+			out[i] = nv
+			changed = changed || ok
+		}
+		if !changed {
+			return v, false
+		}
+		return out, true
+	case []Any:
+		out := make([]Any, len(vv))
+		changed := false
+		for i, one := range vv {
+			nv, ok := rewriteParts(one, parts, fn)
+			out[i] = nv
+			changed = changed || ok
+		}
+		if !changed {
+			return v, false
+		}
+		return out, true
+	case []string:
+		if len(parts) > 0 {
+			return v, false
+		}
+		out := make([]Any, len(vv))
+		changed := false
+		for i, one := range vv {
+			nv, ok := fn(one)
+			out[i] = nv
+			changed = changed || ok
+		}
+		if !changed {
+			return v, false
+		}
+		return out, true
+	}
+	if len(parts) > 0 {
+		return v, false
+	}
+	return fn(v)
+}
+
+// removePath returns a copy of payload without the values at path.
+func removePath(payload Map, path string) Map {
+	if _, ok := payload[path]; ok {
+		out := cloneMap(payload)
+		delete(out, path)
+		return out
+	}
+	parts := strings.Split(path, ".")
+	last := parts[len(parts)-1]
+	if len(parts) == 1 {
+		return payload
+	}
+	out, _ := rewritePath(payload, strings.Join(parts[:len(parts)-1], "."), func(v Any) (Any, bool) {
+		m, ok := v.(Map)
+		if !ok {
+			return v, false
+		}
+		if _, ok := m[last]; !ok {
+			return v, false
+		}
+		m = cloneMap(m)
+		delete(m, last)
+		return m, true
+	})
+	return out
+}
@@ -0,0 +1,119 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/infrago/base"
+)
+
+func pathDoc() Map {
+	return Map{
+		"title":   "go book",
+		"a.b":     "literal",
+		"author":  Map{"name": "Rob Pike", "age": 60},
+		"tags":    []Any{"go", []Any{"lang", "book"}},
+		"reviews": []Map{{"score": 5, "by": "a"}, {"score": 2, "by": "b"}},
+		"a":       Map{"b": "nested"},
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	doc := pathDoc()
+	cases := []struct {
+		path   string
+		values string
+		found  bool
+	}{
+		{"title", "[go book]", true},
+		{"author.name", "[Rob Pike]", true},
+		{"tags", "[go lang book]", true},
+		{"reviews.score", "[5 2]", true},
+		// literal keys win over nested lookups
+		{"a.b", "[literal]", true},
+		{"author.missing", "[]", false},
+		{"title.sub", "[]", false},
+	}
+	for _, one := range cases {
+		values, found := resolvePath(doc, one.path)
+		if fmt.Sprint(values) != one.values || found != one.found {
+			t.Errorf("resolvePath(%s) = %v %v, want %s %v", one.path, values, found, one.values, one.found)
+		}
+	}
+	if got := pathValue(doc, "reviews.score", false); got != 2 {
+		t.Errorf("ascending sort value %v, want 2", got)
+	}
+	if got := pathValue(doc, "reviews.score", true); got != 5 {
+		t.Errorf("descending sort value %v, want 5", got)
+	}
+}
+
+func TestPickAndRemovePath(t *testing.T) {
+	doc := pathDoc()
+	picked, ok := pickPath(doc, "reviews.by")
+	if !ok || fmt.Sprint(picked) != "map[reviews:[map[by:a] map[by:b]]]" {
+		t.Fatalf("pickPath = %v %v", picked, ok)
+	}
+	if _, ok := pickPath(doc, "author.missing"); ok {
+		t.Fatal("picked a missing path")
+	}
+	name, _ := pickPath(doc, "author.name")
+	age, _ := pickPath(doc, "author.age")
+	if got := fmt.Sprint(mergePicked(name, age)); got != "map[author:map[age:60 name:Rob Pike]]" {
+		t.Fatalf("merged %s", got)
+	}
+
+	removed := removePath(doc, "reviews.score")
+	if got := fmt.Sprint(removed["reviews"]); got != "[map[by:a] map[by:b]]" {
+		t.Fatalf("removed %s", got)
+	}
+	// the original payload is left alone
+	if got := fmt.Sprint(doc["reviews"]); got != "[map[by:a score:5] map[by:b score:2]]" {
+		t.Fatalf("payload changed to %s", got)
+	}
+	upper, ok := rewritePath(doc, "author.name", func(v Any) (Any, bool) {
+		return strings.ToUpper(v.(string)), true
+	})
+	if !ok || upper["author"].(Map)["name"] != "ROB PIKE" || doc["author"].(Map)["name"] != "Rob Pike" {
+		t.Fatalf("rewritten %v, payload %v", upper["author"], doc["author"])
+	}
+}
+
+func TestPathSearch(t *testing.T) {
+	c := newConn(t)
+	c.Upsert("p", []Map{
+		{"id": "1", "title": "go book", "author": Map{"name": "Rob Pike", "age": 60}, "tags": []Any{"go", "lang"}, "reviews": []Map{{"score": 5, "by": "a"}, {"score": 2, "by": "b"}}},
+		{"id": "2", "title": "rust book", "author": Map{"name": "Steve", "age": 40}, "tags": []string{"rust", "lang"}, "reviews": []Map{{"score": 3, "by": "c"}}},
+	})
+	cases := []struct {
+		args Map
+		ids  string
+	}{
+		{Map{"author.name": "steve"}, "2"},
+		{Map{"tags": "go"}, "1"},
+		{Map{"reviews.score": Map{"$gte": 5}}, "1"},
+		// arrays match when any element does, negations when none does
+		{Map{"tags": Map{"$ne": "go"}}, "2"},
+		{Map{"reviews.score": Map{"$lt": 3}}, "1"},
+		{Map{"$sort": Map{"author.age": ASC}}, "21"},
+		{Map{"$sort": Map{"reviews.score": DESC}}, "12"},
+	}
+	for _, one := range cases {
+		res, err := c.Search("p", BuildQuery("", one.args))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hitIDs(res.Hits); got != one.ids {
+			t.Errorf("%v matched %s, want %s", one.args, got, one.ids)
+		}
+	}
+
+	res, _ := c.Search("p", BuildQuery("pike", Map{"$facets": "tags", "$fields": "author.name,reviews.by"}))
+	if res.Total != 1 || fmt.Sprint(res.Hits[0].Payload) != "map[author:map[name:Rob Pike] reviews:[map[by:a] map[by:b]]]" {
+		t.Fatalf("nested search returned %v", res.Hits)
+	}
+	if got := fmt.Sprint(res.Facets["tags"]); !strings.Contains(got, "go 1") || !strings.Contains(got, "lang 1") {
+		t.Fatalf("array facets %s", got)
+	}
+}
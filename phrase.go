@@ -0,0 +1,83 @@
+package search
+
+import (
+	"strconv"
+	"strings"
+
+	. "github.com/infrago/base"
+)
+
+// SplitPhrases extracts the quoted phrases of a keyword, `"exact phrase"`
+// or `"a b"~3` for proximity, and returns the remaining keyword. An
+// unbalanced quote is ignored.
+func SplitPhrases(keyword string) (string, []Phrase) {
+	phrases := make([]Phrase, 0)
+	var rest strings.Builder
+	for {
+		open := strings.IndexByte(keyword, '"')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(keyword[open+1:], '"')
+		if end < 0 {
+			break
+		}
+		end += open + 1
+		rest.WriteString(keyword[:open])
+		rest.WriteByte(' ')
+		phrase := Phrase{Text: strings.TrimSpace(keyword[open+1 : end])}
+		keyword = keyword[end+1:]
+		if strings.HasPrefix(keyword, "~") {
+			n := 1
+			for n < len(keyword) && keyword[n] >= '0' && keyword[n] <= '9' {
+				n++
+			}
+			phrase.Slop, _ = strconv.Atoi(keyword[1:n])
+			keyword = keyword[n:]
+		}
+		if phrase.Text != "" {
+			phrases = append(phrases, phrase)
+		}
+	}
+	rest.WriteString(strings.ReplaceAll(keyword, `"`, " "))
+	return strings.Join(strings.Fields(rest.String()), " "), phrases
+}
+
+// parsePhrases accepts "a b", `"a b"~2`, Map{"text": "a b", "slop": 2} or a
+// list of them.
+func parsePhrases(v Any) []Phrase {
+	out := make([]Phrase, 0)
+	switch vv := v.(type) {
+	case Phrase:
+		out = append(out, vv)
+	case []Phrase:
+		out = append(out, vv...)
+	case string:
+		if _, phrases := SplitPhrases(vv); len(phrases) > 0 {
+			out = append(out, phrases...)
+		} else if text := strings.TrimSpace(vv); text != "" {
+			out = append(out, Phrase{Text: text})
+		}
+	case Map:
+		if text, ok := pickString(vv, "text", "phrase"); ok && strings.TrimSpace(text) != "" {
+			phrase := Phrase{Text: strings.TrimSpace(text)}
+			if n, ok := toInt(pickValue(vv, "slop", "distance")); ok && n > 0 {
+				phrase.Slop = n
+			}
+			out = append(out, phrase)
+		}
+	case []Map:
+		for _, one := range vv {
+			out = append(out, parsePhrases(one)...)
+		}
+	case []string:
+		for _, one := range vv {
+			out = append(out, parsePhrases(one)...)
+		}
+	case []Any:
+		for _, one := range vv {
+			out = append(out, parsePhrases(one)...)
+		}
+	}
+	return out
+}
@@ -0,0 +1,13 @@
+package search
+
+import "testing"
+
+func TestSplitPhrases(t *testing.T) {
+	keyword, phrases := SplitPhrases(`go "machine learning" fast "deep  nets"~3 "open`)
+	if keyword != "go fast open" {
+		t.Fatalf("keyword %q", keyword)
+	}
+	if len(phrases) != 2 || phrases[0].Text != "machine learning" || phrases[1].Slop != 3 {
+		t.Fatalf("phrases %+v", phrases)
+	}
+}
@@ -1,13 +1,38 @@
 package search
 
 import (
+	"container/list"
 	"fmt"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	. "github.com/infrago/base"
 )
 
+// SortScore is the pseudo field that sorts hits by relevance score.
+const SortScore = "_score"
+
+// FuzzyAuto lets the fuzzy edit distance depend on the term length: none up
+// to 2 characters, 1 up to 5 and 2 above.
+const FuzzyAuto = -1
+
+// map options handled by this package.
+const (
+	optWithin  = "$within"
+	optBoost   = "$boost"
+	optRanges  = "$ranges"
+	optFuzzy   = "$fuzzy"
+	optPhrase  = "$phrase"
+	optPhrases = "$phrases"
+	optSyntax  = "$syntax"
+	optCursor  = "$cursor"
+	optScroll  = "$scroll"
+)
+
 func BuildQuery(keyword string, args ...Any) Query {
 	q := Query{Keyword: strings.TrimSpace(keyword), Offset: 0, Limit: 20, Raw: Map{}, Setting: Map{}}
 	for _, arg := range args {
@@ -31,6 +56,33 @@ func BuildQuery(keyword string, args ...Any) Query {
 	return q
 }
 
+func BuildSuggestQuery(prefix string, args ...Any) SuggestQuery {
+	q := SuggestQuery{Prefix: prefix, Limit: 10, Setting: Map{}}
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case SuggestQuery:
+			if len(v.Fields) > 0 {
+				q.Fields = append([]string{}, v.Fields...)
+			}
+			if v.Limit > 0 {
+				q.Limit = v.Limit
+			}
+			q.Setting = mergeMaps(q.Setting, v.Setting)
+		case Map:
+			if vv, ok := pickValueOK(v, OptFields, OptSelect); ok {
+				q.Fields = toStrings(vv)
+			}
+			if vv, ok := toInt(pickValue(v, OptLimit)); ok && vv > 0 {
+				q.Limit = vv
+			}
+			if vv, ok := pickMap(v, OptSetting); ok {
+				q.Setting = mergeMaps(q.Setting, vv)
+			}
+		}
+	}
+	return q
+}
+
 func mergeQuery(dst Query, src Query) Query {
 	if strings.TrimSpace(src.Keyword) != "" {
 		dst.Keyword = strings.TrimSpace(src.Keyword)
@@ -41,6 +93,33 @@ func mergeQuery(dst Query, src Query) Query {
 	if src.Limit > 0 {
 		dst.Limit = src.Limit
 	}
+	if strings.TrimSpace(src.Cursor) != "" {
+		dst.Cursor = strings.TrimSpace(src.Cursor)
+	}
+	if src.Scroll > 0 {
+		dst.Scroll = src.Scroll
+	}
+	if src.Syntax {
+		dst.Syntax = true
+	}
+	if len(src.Required) > 0 {
+		dst.Required = append(dst.Required, src.Required...)
+	}
+	if len(src.Excluded) > 0 {
+		dst.Excluded = append(dst.Excluded, src.Excluded...)
+	}
+	if len(src.Should) > 0 {
+		dst.Should = append(dst.Should, src.Should...)
+	}
+	if src.Fuzzy.Distance != 0 {
+		dst.Fuzzy = src.Fuzzy
+	}
+	if len(src.Phrases) > 0 {
+		dst.Phrases = append(dst.Phrases, src.Phrases...)
+	}
+	if len(src.SearchFields) > 0 {
+		dst.SearchFields = append([]FieldBoost{}, src.SearchFields...)
+	}
 	if len(src.Filters) > 0 {
 		dst.Filters = append(dst.Filters, src.Filters...)
 	}
@@ -53,6 +132,9 @@ func mergeQuery(dst Query, src Query) Query {
 	if len(src.Facets) > 0 {
 		dst.Facets = append([]string{}, src.Facets...)
 	}
+	if len(src.RangeFacets) > 0 {
+		dst.RangeFacets = append([]RangeFacet{}, src.RangeFacets...)
+	}
 	if len(src.Highlight) > 0 {
 		dst.Highlight = append([]string{}, src.Highlight...)
 	}
@@ -78,15 +160,36 @@ func mergeQueryMap(dst Query, cfg Map) Query {
 	if v, ok := toInt(pickValue(cfg, OptLimit)); ok {
 		dst.Limit = v
 	}
+	if v, ok := pickString(cfg, optCursor); ok {
+		dst.Cursor = strings.TrimSpace(v)
+	}
+	if v, ok := pickValueOK(cfg, optScroll); ok {
+		dst.Scroll = parseScroll(v)
+	}
 	if v, ok := parseBool(pickValue(cfg, OptPrefix)); ok {
 		dst.Prefix = v
 	}
+	if v, ok := parseBool(pickValue(cfg, optSyntax)); ok {
+		dst.Syntax = v
+	}
+	if v, ok := pickValueOK(cfg, optFuzzy); ok {
+		dst.Fuzzy = parseFuzzy(v)
+	}
+	if v, ok := pickValueOK(cfg, optPhrase, optPhrases); ok {
+		dst.Phrases = append(dst.Phrases, parsePhrases(v)...)
+	}
+	if v, ok := pickValueOK(cfg, optWithin, optBoost); ok {
+		dst.SearchFields = parseFieldBoosts(v)
+	}
 	if v, ok := pickValueOK(cfg, OptFields, OptSelect); ok {
 		dst.Fields = toStrings(v)
 	}
 	if v, ok := pickValueOK(cfg, OptFacets); ok {
 		dst.Facets = toStrings(v)
 	}
+	if v, ok := pickMap(cfg, optRanges); ok {
+		dst.RangeFacets = parseRangeFacets(v)
+	}
 	if v, ok := pickValueOK(cfg, OptHighlight); ok {
 		dst.Highlight = toStrings(v)
 	}
@@ -164,18 +267,114 @@ func parseSorts(v Any) []Sort {
 	return out
 }
 
+// parseFuzzy accepts true/"auto", a distance, or
+// Map{"distance": 1, "prefix": 2}.
+func parseFuzzy(v Any) Fuzzy {
+	if m, ok := v.(Map); ok {
+		out := Fuzzy{Distance: FuzzyAuto}
+		if raw, ok := pickValueOK(m, "distance", "fuzziness"); ok {
+			out.Distance = parseFuzzy(raw).Distance
+		}
+		if n, ok := toInt(pickValue(m, "prefix", "prefix_length")); ok && n > 0 {
+			out.PrefixLength = n
+		}
+		return out
+	}
+	if s, ok := v.(string); ok && strings.EqualFold(strings.TrimSpace(s), "auto") {
+		return Fuzzy{Distance: FuzzyAuto}
+	}
+	if b, ok := v.(bool); ok {
+		if b {
+			return Fuzzy{Distance: FuzzyAuto}
+		}
+		return Fuzzy{}
+	}
+	if n, ok := toInt(v); ok && n > 0 {
+		return Fuzzy{Distance: n}
+	}
+	return Fuzzy{}
+}
+
+// parseFieldBoosts accepts "title^3, body", []string{"title^3", "body"}
+// or Map{"title": 3, "body": 1}.
+func parseFieldBoosts(v Any) []FieldBoost {
+	out := make([]FieldBoost, 0)
+	switch vv := v.(type) {
+	case Map:
+		keys := make([]string, 0, len(vv))
+		for field := range vv {
+			keys = append(keys, field)
+		}
+		sort.Strings(keys)
+		for _, field := range keys {
+			if strings.TrimSpace(field) == "" {
+				continue
+			}
+			boost, ok := toFloat(vv[field])
+			if !ok || boost <= 0 {
+				boost = 1
+			}
+			out = append(out, FieldBoost{Field: strings.TrimSpace(field), Boost: boost})
+		}
+	default:
+		for _, one := range toStrings(vv) {
+			one = strings.TrimSpace(one)
+			if one == "" {
+				continue
+			}
+			boost := 1.0
+			if pos := strings.LastIndex(one, "^"); pos >= 0 {
+				if f, err := strconv.ParseFloat(one[pos+1:], 64); err == nil && f > 0 {
+					boost = f
+				}
+				one = one[:pos]
+			}
+			out = append(out, FieldBoost{Field: one, Boost: boost})
+		}
+	}
+	return out
+}
+
+// parseRangeFacets parses
+// Map{"published": []Map{{"key": "week", "from": "now-7d"}, {"key": "older", "to": "now-7d"}}}
+func parseRangeFacets(cfg Map) []RangeFacet {
+	fields := make([]string, 0, len(cfg))
+	for field := range cfg {
+		if strings.TrimSpace(field) != "" {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	out := make([]RangeFacet, 0, len(fields))
+	for _, field := range fields {
+		facet := RangeFacet{Field: strings.TrimSpace(field)}
+		for _, one := range toAnys(cfg[field]) {
+			rm, ok := one.(Map)
+			if !ok {
+				continue
+			}
+			r := FacetRange{From: rm["from"], To: rm["to"]}
+			if key, ok := rm["key"].(string); ok {
+				r.Key = key
+			}
+			facet.Ranges = append(facet.Ranges, r)
+		}
+		if len(facet.Ranges) > 0 {
+			out = append(out, facet)
+		}
+	}
+	return out
+}
+
 func parseFilters(v Any) []Filter {
 	out := make([]Filter, 0)
 	switch vv := v.(type) {
 	case Map:
-		for key, val := range vv {
-			out = append(out, parseFieldFilters(key, val)...)
-		}
+		out = append(out, parseFilterMap(vv)...)
 	case []Map:
 		for _, one := range vv {
-			for field, val := range one {
-				out = append(out, parseFieldFilters(field, val)...)
-			}
+			out = append(out, parseFilterMap(one)...)
 		}
 	case []Any:
 		for _, one := range vv {
@@ -185,6 +384,55 @@ func parseFilters(v Any) []Filter {
 	return out
 }
 
+// parseFilterMap parses field filters and logical operators of one map,
+// all of them are ANDed by the caller.
+func parseFilterMap(m Map) []Filter {
+	out := make([]Filter, 0)
+	for key, val := range m {
+		if strings.HasPrefix(key, "$") {
+			if op := normalizeFilterOp(key); isLogicalOp(op) {
+				out = append(out, parseLogicalFilter(op, val))
+			}
+			continue
+		}
+		out = append(out, parseFieldFilters(key, val)...)
+	}
+	return out
+}
+
+// parseLogicalFilter parses $and/$or/$nor with a list of maps, every map
+// being an ANDed group, and $not with a map or a list of maps, negated all
+// together: NOT(a AND b). Groups left empty are rejected by checkFilters.
+// {"$or": []Map{{"category": Map{"$in": []string{"a", "b"}}}, {"featured": true}}}
+func parseLogicalFilter(op string, val Any) Filter {
+	groups := make([]Filter, 0)
+	add := func(m Map) {
+		filters := parseFilterMap(m)
+		switch len(filters) {
+		case 0:
+		case 1:
+			groups = append(groups, filters[0])
+		default:
+			groups = append(groups, Filter{Op: FilterAnd, Filters: filters})
+		}
+	}
+	switch vv := val.(type) {
+	case Map:
+		add(vv)
+	case []Map:
+		for _, one := range vv {
+			add(one)
+		}
+	case []Any:
+		for _, one := range vv {
+			if m, ok := one.(Map); ok {
+				add(m)
+			}
+		}
+	}
+	return Filter{Op: op, Filters: groups}
+}
+
 func parseFieldFilters(field string, val Any) []Filter {
 	field = strings.TrimSpace(field)
 	if field == "" {
@@ -205,6 +453,12 @@ func parseFieldFilters(field string, val Any) []Filter {
 			case FilterIn, FilterNin:
 				out = append(out, Filter{Field: field, Op: op, Values: toAnys(opVal)})
 				handled = true
+			case FilterExists, FilterMissing, FilterPrefix, FilterContains, FilterWildcard, FilterRegex:
+				out = append(out, Filter{Field: field, Op: op, Value: opVal})
+				handled = true
+			case FilterNot:
+				out = append(out, Filter{Op: FilterNot, Filters: parseFieldFilters(field, opVal)})
+				handled = true
 			case FilterRange:
 				if rv, ok := opVal.(Map); ok {
 					out = append(out, Filter{Field: field, Op: FilterRange, Min: rv["min"], Max: rv["max"]})
@@ -214,6 +468,12 @@ func parseFieldFilters(field string, val Any) []Filter {
 				handled = true
 			case "op", "value", "values", "min", "max":
 				// handled below
+			default:
+				// keep unknown operators so that checkFilters reports them
+				if strings.HasPrefix(opKey, "$") {
+					out = append(out, Filter{Field: field, Op: op, Value: opVal})
+					handled = true
+				}
 			}
 		}
 		if handled {
@@ -284,6 +544,14 @@ func normalizeFilterOp(op string) string {
 		return FilterLte
 	case "not_in":
 		return FilterNin
+	case "starts_with", "startswith":
+		return FilterPrefix
+	case "like":
+		return FilterContains
+	case "glob":
+		return FilterWildcard
+	case "regexp":
+		return FilterRegex
 	default:
 		return s
 	}
@@ -374,9 +642,11 @@ func parseTopLevelFilters(cfg Map) []Filter {
 	reserved := map[string]struct{}{
 		OptKeyword: {}, OptQuery: {},
 		OptPrefix: {},
-		OptOffset: {}, OptLimit: {},
+		optWithin: {}, optBoost: {}, optFuzzy: {},
+		optPhrase: {}, optPhrases: {}, optSyntax: {},
+		OptOffset: {}, OptLimit: {}, optCursor: {}, optScroll: {},
 		OptFields: {}, OptSelect: {},
-		OptFacets:    {},
+		OptFacets: {}, optRanges: {},
 		OptHighlight: {},
 		OptSetting:   {},
 		OptRaw:       {},
@@ -390,6 +660,9 @@ func parseTopLevelFilters(cfg Map) []Filter {
 			continue
 		}
 		if strings.HasPrefix(key, "$") {
+			if op := normalizeFilterOp(key); isLogicalOp(op) {
+				out = append(out, parseLogicalFilter(op, val))
+			}
 			continue
 		}
 		out = append(out, parseFieldFilters(key, val)...)
@@ -419,53 +692,286 @@ func parseBool(v Any) (bool, bool) {
 	return false, false
 }
 
+// FilterMatch reports whether a payload passes a filter, text filters
+// analyze with the standard analyzer and relative dates are resolved
+// against the time of the call.
 func FilterMatch(filter Filter, payload Map) bool {
+	filter = resolveFilters([]Filter{filter}, time.Now())[0]
+	return matchFilter(filter, payload, func(string) Analyzer {
+		return module.IndexAnalyzer(Index{})
+	})
+}
+
+// matchFilter is FilterMatch with the analyzer of each field, for drivers
+// that analyze fields differently.
+func matchFilter(filter Filter, payload Map, analyzer func(field string) Analyzer) bool {
 	if payload == nil {
 		return false
 	}
-	val, ok := payload[filter.Field]
-	if !ok {
-		return false
-	}
-	op := strings.ToLower(strings.TrimSpace(filter.Op))
+	op := normalizeFilterOp(filter.Op)
 	if op == "" {
 		op = FilterEq
 	}
 	switch op {
-	case FilterEq, "=":
-		return compareEqual(val, filter.Value)
-	case FilterNe, "!=":
-		return !compareEqual(val, filter.Value)
-	case FilterIn:
-		for _, one := range filter.Values {
-			if compareEqual(val, one) {
+	case FilterAnd:
+		for _, one := range filter.Filters {
+			if !matchFilter(one, payload, analyzer) {
+				return false
+			}
+		}
+		return true
+	case FilterOr:
+		for _, one := range filter.Filters {
+			if matchFilter(one, payload, analyzer) {
 				return true
 			}
 		}
+		return len(filter.Filters) == 0
+	case FilterNor:
+		for _, one := range filter.Filters {
+			if matchFilter(one, payload, analyzer) {
+				return false
+			}
+		}
+		return true
+	case FilterNot:
+		for _, one := range filter.Filters {
+			if !matchFilter(one, payload, analyzer) {
+				return true
+			}
+		}
+		return len(filter.Filters) == 0
+	}
+
+	// values at the path, arrays fan out and match when any element does
+	values, found := resolvePath(payload, filter.Field)
+	exists := false
+	for _, val := range values {
+		if val != nil {
+			exists = true
+			break
+		}
+	}
+	switch op {
+	case FilterExists:
+		if want, ok := parseBool(filter.Value); ok && !want {
+			return !exists
+		}
+		return exists
+	case FilterMissing:
+		return !exists
+	}
+	if !found {
+		return false
+	}
+
+	switch op {
+	case FilterText:
+		field := analyzer(filter.Field)
+		text := fmt.Sprintf("%v", filter.Value)
+		prefix := strings.HasSuffix(text, "*")
+		terms := field.Analyze(strings.TrimSuffix(text, "*"))
+		return matchAny(values, func(val Any) bool {
+			return containsTerms(field.Analyze(fmt.Sprintf("%v", val)), terms, prefix)
+		})
+	case FilterNe:
+		return !matchAny(values, func(val Any) bool { return compareEqual(val, filter.Value) })
+	case FilterNin:
+		return !matchAny(values, func(val Any) bool { return matchValue(FilterIn, filter, val) })
+	default:
+		return matchAny(values, func(val Any) bool { return matchValue(op, filter, val) })
+	}
+}
+
+func matchAny(values []Any, fn func(Any) bool) bool {
+	for _, val := range values {
+		if fn(val) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsTerms reports whether tokens hold the terms at the same relative
+// positions, gaps left by stop words included. With prefix the last term
+// only has to start a token.
+func containsTerms(tokens, terms []Token, prefix bool) bool {
+	if len(terms) == 0 {
 		return false
-	case FilterNin, "not_in":
+	}
+	at := make(map[int]string, len(tokens))
+	for _, token := range tokens {
+		at[token.Position] = token.Term
+	}
+	same := func(n int, got string) bool {
+		if prefix && n == len(terms)-1 {
+			return got != "" && strings.HasPrefix(got, terms[n].Term)
+		}
+		return got == terms[n].Term
+	}
+	for _, token := range tokens {
+		if !same(0, token.Term) {
+			continue
+		}
+		ok := true
+		for n := 1; n < len(terms); n++ {
+			if !same(n, at[token.Position+terms[n].Position-terms[0].Position]) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchValue evaluates a positive operator against a single value.
+func matchValue(op string, filter Filter, val Any) bool {
+	switch op {
+	case FilterEq:
+		return compareEqual(val, filter.Value)
+	case FilterIn:
 		for _, one := range filter.Values {
 			if compareEqual(val, one) {
-				return false
+				return true
 			}
 		}
-		return true
-	case FilterGt, ">":
+		return false
+	case FilterGt:
 		return compareNumber(val, filter.Value, ">")
-	case FilterGte, ">=":
+	case FilterGte:
 		return compareNumber(val, filter.Value, ">=")
-	case FilterLt, "<":
+	case FilterLt:
 		return compareNumber(val, filter.Value, "<")
-	case FilterLte, "<=":
+	case FilterLte:
 		return compareNumber(val, filter.Value, "<=")
 	case FilterRange:
 		return compareRange(val, filter.Min, filter.Max)
+	case FilterPrefix:
+		return strings.HasPrefix(strings.ToLower(fmt.Sprintf("%v", val)), strings.ToLower(fmt.Sprintf("%v", filter.Value)))
+	case FilterContains:
+		return strings.Contains(strings.ToLower(fmt.Sprintf("%v", val)), strings.ToLower(fmt.Sprintf("%v", filter.Value)))
+	case FilterWildcard, FilterRegex:
+		re, err := filterRegexp(op, filter.Value)
+		if err != nil {
+			return false
+		}
+		return re.MatchString(fmt.Sprintf("%v", val))
 	default:
-		return compareEqual(val, filter.Value)
+		// unknown operators never match, see checkFilters
+		return false
 	}
 }
 
+// checkFilters reports unknown operators, invalid patterns and $and, $or
+// or $nor without conditions, which would match everything.
+func checkFilters(filters []Filter) error {
+	var err error
+	walkFilters(filters, func(f Filter) {
+		if err != nil {
+			return
+		}
+		op := normalizeFilterOp(f.Op)
+		if (op == FilterAnd || op == FilterOr || op == FilterNor) && len(f.Filters) == 0 {
+			err = fmt.Errorf("search filter $%s has no conditions", op)
+			return
+		}
+		if op == "" || isLogicalOp(op) {
+			return
+		}
+		if !isFieldOp(op) {
+			err = fmt.Errorf("search filter %s has unknown operator %s", f.Field, f.Op)
+			return
+		}
+		if op == FilterWildcard || op == FilterRegex {
+			if _, e := filterRegexp(op, f.Value); e != nil {
+				err = fmt.Errorf("search filter %s has invalid %s pattern: %s", f.Field, op, e.Error())
+			}
+		}
+	})
+	return err
+}
+
+// filterRegexpLimit bounds the compiled patterns kept for reuse.
+const filterRegexpLimit = 256
+
+// regexpCache keeps the most recently used compiled patterns.
+type regexpCache struct {
+	mutex sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+type regexpEntry struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+var filterRegexps = &regexpCache{order: list.New(), items: map[string]*list.Element{}}
+
+func (c *regexpCache) get(pattern string) (*regexp.Regexp, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elem, ok := c.items[pattern]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*regexpEntry).re, true
+}
+
+func (c *regexpCache) put(pattern string, re *regexp.Regexp) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if elem, ok := c.items[pattern]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[pattern] = c.order.PushFront(&regexpEntry{pattern, re})
+	for c.order.Len() > filterRegexpLimit {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*regexpEntry).pattern)
+	}
+}
+
+// filterRegexp compiles and caches the pattern of a wildcard or regex
+// filter, wildcards support * and ? and match case-insensitively.
+func filterRegexp(op string, value Any) (*regexp.Regexp, error) {
+	pattern := fmt.Sprintf("%v", value)
+	if op == FilterWildcard {
+		var sb strings.Builder
+		sb.WriteString("(?is)^")
+		for _, r := range pattern {
+			switch r {
+			case '*':
+				sb.WriteString(".*")
+			case '?':
+				sb.WriteString(".")
+			default:
+				sb.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		sb.WriteString("$")
+		pattern = sb.String()
+	}
+	if re, ok := filterRegexps.get(pattern); ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	filterRegexps.put(pattern, re)
+	return re, nil
+}
+
 func compareEqual(a, b Any) bool {
+	if cmp, ok := compareTimes(a, b); ok {
+		return cmp == 0
+	}
 	if fa, oka := toFloat(a); oka {
 		if fb, okb := toFloat(b); okb {
 			return fa == fb
@@ -474,43 +980,58 @@ func compareEqual(a, b Any) bool {
 	return strings.EqualFold(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
 }
 
-func compareNumber(a, b Any, op string) bool {
+// compareOrdered compares two values as dates or numbers, ok is false
+// when they are neither.
+func compareOrdered(a, b Any) (int, bool) {
+	if cmp, ok := compareTimes(a, b); ok {
+		return cmp, true
+	}
 	fa, oka := toFloat(a)
 	fb, okb := toFloat(b)
 	if !oka || !okb {
+		return 0, false
+	}
+	switch {
+	case fa < fb:
+		return -1, true
+	case fa > fb:
+		return 1, true
+	default:
+		return 0, true
+	}
+}
+
+func compareNumber(a, b Any, op string) bool {
+	cmp, ok := compareOrdered(a, b)
+	if !ok {
 		return false
 	}
 	switch op {
 	case ">":
-		return fa > fb
+		return cmp > 0
 	case ">=":
-		return fa >= fb
+		return cmp >= 0
 	case "<":
-		return fa < fb
+		return cmp < 0
 	case "<=":
-		return fa <= fb
+		return cmp <= 0
 	default:
 		return false
 	}
 }
 
 func compareRange(v, min, max Any) bool {
-	fv, ok := toFloat(v)
-	if !ok {
+	if _, ok := compareOrdered(v, v); !ok {
 		return false
 	}
 	if min != nil {
-		if fmin, ok := toFloat(min); ok {
-			if fv < fmin {
-				return false
-			}
+		if cmp, ok := compareOrdered(v, min); ok && cmp < 0 {
+			return false
 		}
 	}
 	if max != nil {
-		if fmax, ok := toFloat(max); ok {
-			if fv > fmax {
-				return false
-			}
+		if cmp, ok := compareOrdered(v, max); ok && cmp > 0 {
+			return false
 		}
 	}
 	return true
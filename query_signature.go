@@ -11,22 +11,40 @@ import (
 )
 
 func QuerySignature(index string, q Query) string {
-	parts := make([]string, 0, 12)
+	parts := make([]string, 0, 22)
 	parts = append(parts, "index="+strings.TrimSpace(index))
 	parts = append(parts, "keyword="+strings.TrimSpace(q.Keyword))
 	parts = append(parts, fmt.Sprintf("prefix=%t", q.Prefix))
+	parts = append(parts, fmt.Sprintf("syntax=%t", q.Syntax))
+	parts = append(parts, "required="+strings.Join(q.Required, ","))
+	parts = append(parts, "excluded="+strings.Join(q.Excluded, ","))
+	parts = append(parts, "should="+shouldSignature(q.Should))
+	parts = append(parts, fmt.Sprintf("fuzzy=%d/%d", q.Fuzzy.Distance, q.Fuzzy.PrefixLength))
+	parts = append(parts, "phrases="+phraseSignature(q.Phrases))
+	parts = append(parts, "within="+fieldBoostSignature(q.SearchFields))
 	parts = append(parts, "filters="+filterSignature(q.Filters))
 	parts = append(parts, "sorts="+sortSignature(q.Sorts))
 	parts = append(parts, "fields="+strings.Join(q.Fields, ","))
 	parts = append(parts, "facets="+strings.Join(q.Facets, ","))
+	parts = append(parts, "ranges="+rangeFacetSignature(q.RangeFacets))
 	parts = append(parts, "highlight="+strings.Join(q.Highlight, ","))
 	parts = append(parts, fmt.Sprintf("offset=%d", q.Offset))
 	parts = append(parts, fmt.Sprintf("limit=%d", q.Limit))
+	parts = append(parts, "cursor="+q.Cursor)
+	parts = append(parts, fmt.Sprintf("scroll=%s", q.Scroll))
 	parts = append(parts, "raw="+stableAnySignature(q.Raw))
 	parts = append(parts, "setting="+stableAnySignature(q.Setting))
 	return strings.Join(parts, "|")
 }
 
+func shouldSignature(groups [][]string) string {
+	parts := make([]string, 0, len(groups))
+	for _, group := range groups {
+		parts = append(parts, fmt.Sprintf("%q", group))
+	}
+	return strings.Join(parts, ",")
+}
+
 func filterSignature(filters []Filter) string {
 	if len(filters) == 0 {
 		return ""
@@ -40,12 +58,43 @@ func filterSignature(filters []Filter) string {
 			stableAnySignature(f.Values),
 			stableAnySignature(f.Min),
 			stableAnySignature(f.Max),
+			"(" + filterSignature(f.Filters) + ")",
 		}, ":"))
 	}
 	sort.Strings(parts)
 	return strings.Join(parts, ",")
 }
 
+func fieldBoostSignature(in []FieldBoost) string {
+	parts := make([]string, 0, len(in))
+	for _, fb := range in {
+		parts = append(parts, fmt.Sprintf("%s^%g", strings.TrimSpace(fb.Field), fb.Boost))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func phraseSignature(in []Phrase) string {
+	parts := make([]string, 0, len(in))
+	for _, p := range in {
+		parts = append(parts, fmt.Sprintf("%q~%d", p.Text, p.Slop))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func rangeFacetSignature(in []RangeFacet) string {
+	parts := make([]string, 0, len(in))
+	for _, rf := range in {
+		ranges := make([]string, 0, len(rf.Ranges))
+		for _, r := range rf.Ranges {
+			ranges = append(ranges, r.Key+"="+stableAnySignature(r.From)+"~"+stableAnySignature(r.To))
+		}
+		parts = append(parts, strings.TrimSpace(rf.Field)+"("+strings.Join(ranges, ";")+")")
+	}
+	return strings.Join(parts, ",")
+}
+
 func sortSignature(in []Sort) string {
 	parts := make([]string, 0, len(in))
 	for _, s := range in {
@@ -0,0 +1,32 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/infrago/base"
+)
+
+func TestParseFieldBoosts(t *testing.T) {
+	cases := []struct {
+		in   Any
+		want string
+	}{
+		{"title^3, body", "[{title 3} {body 1}]"},
+		{[]string{"title^2.5", " author.name "}, "[{title 2.5} {author.name 1}]"},
+		{"title^0, body^x", "[{title 1} {body 1}]"},
+		{Map{"title": 3, "body": "x", " ": 2}, "[{body 1} {title 3}]"},
+		{"", "[]"},
+	}
+	for _, one := range cases {
+		if got := fmt.Sprint(parseFieldBoosts(one.in)); got != one.want {
+			t.Errorf("parseFieldBoosts(%v) = %s, want %s", one.in, got, one.want)
+		}
+	}
+
+	a := QuerySignature("w", BuildQuery("x", Map{"$within": "title^3, author"}))
+	b := QuerySignature("w", BuildQuery("x", Map{"$within": "title, author"}))
+	if a == b {
+		t.Fatal("signature ignores field boosts")
+	}
+}
@@ -0,0 +1,663 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	. "github.com/infrago/base"
+)
+
+// query string node kinds.
+const (
+	QueryTerm    = "term"
+	QueryPhrase  = "phrase"
+	QueryRange   = "range"
+	QueryCompare = "compare"
+	QueryGroup   = "group"
+	QueryOr      = "or"
+)
+
+type (
+	// QueryNode is one node of a parsed query string such as
+	// `title:golang -draft tag:(api OR sdk) price:[10 TO 50]`. Occur is "+"
+	// for required and "-" for excluded clauses, Field is set for field
+	// clauses and inherited by the children of a field group.
+	QueryNode struct {
+		Kind     string
+		Occur    string
+		Field    string
+		Text     string
+		Wildcard bool
+		Slop     int
+		Op       string
+		From     string
+		To       string
+		FromIncl bool
+		ToIncl   bool
+		Children []QueryNode
+		Pos      int
+	}
+
+	// SyntaxError reports an invalid query string, Pos is the offset in
+	// characters where the problem was found.
+	SyntaxError struct {
+		Pos int
+		Msg string
+	}
+)
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("search query syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+// ParseQueryString parses a Lucene like query string: terms, "phrases"~2,
+// +required and -excluded (or NOT) clauses, field:value, field:(a OR b),
+// field:[from TO to] with {} for exclusive bounds and * for open ones,
+// field:>=value, groups in parentheses and AND/OR/&&/||. AND binds
+// tighter than OR and is implied between clauses.
+func ParseQueryString(s string) (QueryNode, error) {
+	p := &queryParser{input: []rune(s)}
+	node, err := p.parseOr("", 0)
+	if err != nil {
+		return QueryNode{}, err
+	}
+	if p.pos < len(p.input) {
+		return QueryNode{}, p.errorf(p.pos, "unexpected %q", p.input[p.pos])
+	}
+	return node, nil
+}
+
+type queryParser struct {
+	input []rune
+	pos   int
+}
+
+func (p *queryParser) errorf(pos int, format string, args ...Any) error {
+	return &SyntaxError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *queryParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *queryParser) peek() rune {
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+// operator returns the boolean operator at the cursor without consuming it.
+func (p *queryParser) operator() string {
+	for _, op := range []string{"AND", "OR", "NOT", "&&", "||"} {
+		end := p.pos + len(op)
+		if end > len(p.input) || string(p.input[p.pos:end]) != op {
+			continue
+		}
+		if end == len(p.input) || unicode.IsSpace(p.input[end]) || p.input[end] == '(' || p.input[end] == '"' {
+			return op
+		}
+	}
+	return ""
+}
+
+// parseOr parses clauses up to close (0 for the end of input), AND groups
+// separated by OR.
+func (p *queryParser) parseOr(field string, close rune) (QueryNode, error) {
+	start := p.pos
+	alternatives := make([]QueryNode, 0, 1)
+	current := make([]QueryNode, 0)
+	pending := -1
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.input) || (close != 0 && p.peek() == close) {
+			break
+		}
+		switch op := p.operator(); op {
+		case "OR", "||", "AND", "&&":
+			if len(current) == 0 || pending >= 0 {
+				return QueryNode{}, p.errorf(p.pos, "%s without left operand", op)
+			}
+			if op == "OR" || op == "||" {
+				alternatives = append(alternatives, groupNode(field, current, start))
+				current = make([]QueryNode, 0)
+			}
+			pending = p.pos
+			p.pos += len(op)
+			continue
+		}
+		clause, err := p.parseClause(field)
+		if err != nil {
+			return QueryNode{}, err
+		}
+		current = append(current, clause)
+		pending = -1
+	}
+	if pending >= 0 {
+		return QueryNode{}, p.errorf(pending, "operator without right operand")
+	}
+	if len(alternatives) == 0 {
+		return groupNode(field, current, start), nil
+	}
+	alternatives = append(alternatives, groupNode(field, current, start))
+	return QueryNode{Kind: QueryOr, Field: field, Children: alternatives, Pos: start}, nil
+}
+
+// groupNode unwraps single clause groups.
+func groupNode(field string, clauses []QueryNode, pos int) QueryNode {
+	if len(clauses) == 1 && clauses[0].Occur == "" {
+		return clauses[0]
+	}
+	return QueryNode{Kind: QueryGroup, Field: field, Children: clauses, Pos: pos}
+}
+
+func (p *queryParser) parseClause(field string) (QueryNode, error) {
+	start := p.pos
+	occur := ""
+	switch {
+	case p.peek() == '+':
+		occur = "+"
+		p.pos++
+	case p.peek() == '-' || p.peek() == '!':
+		occur = "-"
+		p.pos++
+	case p.operator() == "NOT":
+		occur = "-"
+		p.pos += 3
+		p.skipSpaces()
+	}
+	if occur != "" && (p.pos >= len(p.input) || unicode.IsSpace(p.peek())) {
+		return QueryNode{}, p.errorf(start, "missing clause after %s", strings.TrimSpace(string(p.input[start:p.pos])))
+	}
+	node, err := p.parsePrimary(field)
+	if err != nil {
+		return QueryNode{}, err
+	}
+	node.Occur = occur
+	node.Pos = start
+	return node, nil
+}
+
+func (p *queryParser) parsePrimary(field string) (QueryNode, error) {
+	start := p.pos
+	switch p.peek() {
+	case '(':
+		return p.parseParens(field)
+	case '"':
+		return p.parsePhrase(field)
+	case ')', ']', '}', ':':
+		return QueryNode{}, p.errorf(p.pos, "unexpected %q", p.peek())
+	case '[', '{':
+		if field == "" {
+			return QueryNode{}, p.errorf(p.pos, "range without a field")
+		}
+		return p.parseRange(field, start)
+	}
+	word, wildcard, err := p.parseWord()
+	if err != nil {
+		return QueryNode{}, err
+	}
+	if p.peek() == ':' {
+		if field != "" {
+			return QueryNode{}, p.errorf(start, "nested field %s inside field %s", word, field)
+		}
+		p.pos++
+		return p.parseValue(word, start)
+	}
+	if p.peek() == '~' {
+		return QueryNode{}, p.errorf(p.pos, "proximity is only supported on phrases")
+	}
+	return QueryNode{Kind: QueryTerm, Field: field, Text: word, Wildcard: wildcard, Pos: start}, nil
+}
+
+func (p *queryParser) parseParens(field string) (QueryNode, error) {
+	open := p.pos
+	p.pos++
+	node, err := p.parseOr(field, ')')
+	if err != nil {
+		return QueryNode{}, err
+	}
+	if p.peek() != ')' {
+		return QueryNode{}, p.errorf(open, "missing ) for this (")
+	}
+	p.pos++
+	if node.Kind == QueryTerm || node.Kind == QueryPhrase {
+		// keep the parentheses of a single clause group, like field:(api)
+		return QueryNode{Kind: QueryGroup, Field: field, Children: []QueryNode{node}, Pos: open}, nil
+	}
+	node.Pos = open
+	return node, nil
+}
+
+// parseWord reads a term, a backslash escapes the next character, an
+// unescaped * or ? makes it a wildcard.
+func (p *queryParser) parseWord() (string, bool, error) {
+	start := p.pos
+	var sb strings.Builder
+	wildcard := false
+	for p.pos < len(p.input) {
+		r := p.input[p.pos]
+		if r == '\\' {
+			if p.pos+1 >= len(p.input) {
+				return "", false, p.errorf(p.pos, "escape at end of input")
+			}
+			sb.WriteRune(p.input[p.pos+1])
+			p.pos += 2
+			continue
+		}
+		if unicode.IsSpace(r) || strings.ContainsRune(`()[]{}:"~`, r) {
+			break
+		}
+		if r == '*' || r == '?' {
+			wildcard = true
+		}
+		sb.WriteRune(r)
+		p.pos++
+	}
+	if p.pos == start {
+		return "", false, p.errorf(start, "missing term")
+	}
+	return sb.String(), wildcard, nil
+}
+
+func (p *queryParser) parsePhrase(field string) (QueryNode, error) {
+	start := p.pos
+	p.pos++
+	var sb strings.Builder
+	for {
+		if p.pos >= len(p.input) {
+			return QueryNode{}, p.errorf(start, "unterminated phrase")
+		}
+		r := p.input[p.pos]
+		if r == '\\' && p.pos+1 < len(p.input) {
+			sb.WriteRune(p.input[p.pos+1])
+			p.pos += 2
+			continue
+		}
+		p.pos++
+		if r == '"' {
+			break
+		}
+		sb.WriteRune(r)
+	}
+	node := QueryNode{Kind: QueryPhrase, Field: field, Text: sb.String(), Pos: start}
+	if p.peek() == '~' {
+		p.pos++
+		digits := p.pos
+		for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+			p.pos++
+		}
+		if p.pos == digits {
+			return QueryNode{}, p.errorf(digits, "missing proximity distance after ~")
+		}
+		node.Slop, _ = strconv.Atoi(string(p.input[digits:p.pos]))
+	}
+	return node, nil
+}
+
+// parseValue parses what follows "field:".
+func (p *queryParser) parseValue(field string, start int) (QueryNode, error) {
+	switch p.peek() {
+	case 0, ' ', '\t', '\n', '\r':
+		return QueryNode{}, p.errorf(p.pos, "missing value for field %s", field)
+	case '(':
+		node, err := p.parseParens(field)
+		if err != nil {
+			return QueryNode{}, err
+		}
+		node.Field = field
+		return node, nil
+	case '"':
+		return p.parsePhrase(field)
+	case '[', '{':
+		return p.parseRange(field, start)
+	case '>', '<':
+		op := string(p.peek())
+		p.pos++
+		if p.peek() == '=' {
+			op += "="
+			p.pos++
+		}
+		value, _, err := p.parseWord()
+		if err != nil {
+			return QueryNode{}, err
+		}
+		return QueryNode{Kind: QueryCompare, Field: field, Op: op, Text: value, Pos: start}, nil
+	}
+	return p.parsePrimary(field)
+}
+
+func (p *queryParser) parseRange(field string, start int) (QueryNode, error) {
+	open := p.pos
+	node := QueryNode{Kind: QueryRange, Field: field, FromIncl: p.peek() == '[', Pos: start}
+	p.pos++
+	bound := func() (string, error) {
+		p.skipSpaces()
+		if p.peek() == '"' {
+			phrase, err := p.parsePhrase(field)
+			return phrase.Text, err
+		}
+		word, _, err := p.parseWord()
+		return word, err
+	}
+	var err error
+	if node.From, err = bound(); err != nil {
+		return QueryNode{}, err
+	}
+	p.skipSpaces()
+	if p.pos+3 > len(p.input) || string(p.input[p.pos:p.pos+2]) != "TO" || !unicode.IsSpace(p.input[p.pos+2]) {
+		return QueryNode{}, p.errorf(p.pos, "expected TO in range")
+	}
+	p.pos += 3
+	if node.To, err = bound(); err != nil {
+		return QueryNode{}, err
+	}
+	p.skipSpaces()
+	switch p.peek() {
+	case ']':
+		node.ToIncl = true
+	case '}':
+	default:
+		return QueryNode{}, p.errorf(open, "missing ] or } for this range")
+	}
+	p.pos++
+	return node, nil
+}
+
+// String formats the node back into query string syntax.
+func (n QueryNode) String() string {
+	return n.format("")
+}
+
+func (n QueryNode) format(field string) string {
+	var sb strings.Builder
+	sb.WriteString(n.Occur)
+	if n.Field != "" && n.Field != field {
+		sb.WriteString(escapeQueryTerm(n.Field, false))
+		sb.WriteString(":")
+	}
+	switch n.Kind {
+	case QueryTerm:
+		sb.WriteString(escapeQueryTerm(n.Text, n.Wildcard))
+	case QueryPhrase:
+		sb.WriteString(strconv.Quote(n.Text))
+		if n.Slop > 0 {
+			sb.WriteString("~" + strconv.Itoa(n.Slop))
+		}
+	case QueryCompare:
+		sb.WriteString(n.Op + escapeQueryTerm(n.Text, false))
+	case QueryRange:
+		open, close := "{", "}"
+		if n.FromIncl {
+			open = "["
+		}
+		if n.ToIncl {
+			close = "]"
+		}
+		sb.WriteString(open + escapeQueryBound(n.From) + " TO " + escapeQueryBound(n.To) + close)
+	case QueryGroup, QueryOr:
+		sep := " "
+		if n.Kind == QueryOr {
+			sep = " OR "
+		}
+		parts := make([]string, 0, len(n.Children))
+		for _, child := range n.Children {
+			part := child.format(n.Field)
+			nested := child.Kind == QueryOr || (child.Kind == QueryGroup && n.Kind == QueryGroup)
+			if nested && child.Occur == "" && (child.Field == "" || child.Field == n.Field) {
+				part = "(" + part + ")"
+			}
+			parts = append(parts, part)
+		}
+		inner := strings.Join(parts, sep)
+		if n.Field != "" || n.Occur != "" || field != "" {
+			inner = "(" + inner + ")"
+		}
+		sb.WriteString(inner)
+	}
+	return sb.String()
+}
+
+func escapeQueryTerm(s string, wildcard bool) string {
+	var sb strings.Builder
+	for i, r := range s {
+		special := strings.ContainsRune(`\()[]{}:"~`, r) || unicode.IsSpace(r)
+		special = special || (!wildcard && (r == '*' || r == '?'))
+		special = special || (i == 0 && strings.ContainsRune("+-!", r))
+		if special {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	out := sb.String()
+	switch out {
+	case "AND", "OR", "NOT", "TO", "&&", "||":
+		out = `\` + out
+	}
+	return out
+}
+
+func escapeQueryBound(s string) string {
+	if s == "*" {
+		return s
+	}
+	return escapeQueryTerm(s, false)
+}
+
+// buildQuery builds the query of a call on an index, parsing its keyword
+// against the index schema when Syntax is set.
+func (m *Module) buildQuery(index, keyword string, args ...Any) (Query, error) {
+	m.mutex.RLock()
+	schema := m.indexes[index].Schema
+	m.mutex.RUnlock()
+	return applySyntax(BuildQuery(keyword, args...), schema)
+}
+
+// applySyntax parses the keyword of a query with Syntax set: free terms
+// stay in the keyword, +terms go to Required, -terms and -"phrases" to
+// Excluded, phrases to Phrases, an OR between keyword terms or phrases to
+// Should and field clauses become filters. Terms and phrases on text fields
+// of the schema, or on any field without a schema, match their analyzed
+// terms, on other fields the whole value.
+func applySyntax(query Query, schema Fields) (Query, error) {
+	if !query.Syntax {
+		return query, nil
+	}
+	node, err := ParseQueryString(query.Keyword)
+	if err != nil {
+		return query, err
+	}
+	clauses := []QueryNode{node}
+	if node.Kind == QueryGroup && node.Field == "" && node.Occur == "" {
+		clauses = node.Children
+	}
+
+	keywords := make([]string, 0)
+	for _, clause := range clauses {
+		if clause.Field == "" && (clause.Kind == QueryTerm || clause.Kind == QueryPhrase) {
+			switch {
+			case clause.Occur == "-":
+				clause.Occur = ""
+				if clause.Kind == QueryTerm {
+					query.Excluded = append(query.Excluded, clause.Text)
+				} else {
+					query.Excluded = append(query.Excluded, clause.String())
+				}
+			case clause.Kind == QueryPhrase:
+				query.Phrases = append(query.Phrases, Phrase{Text: clause.Text, Slop: clause.Slop})
+			case clause.Occur == "+":
+				query.Required = append(query.Required, clause.Text)
+			default:
+				keywords = append(keywords, clause.Text)
+			}
+			continue
+		}
+		if alternatives, ok := keywordAlternatives(clause); ok {
+			if clause.Occur == "-" {
+				query.Excluded = append(query.Excluded, alternatives...)
+			} else {
+				query.Should = append(query.Should, alternatives)
+			}
+			continue
+		}
+		filters, err := queryFilters(clause, schema)
+		if err != nil {
+			return query, err
+		}
+		query.Filters = append(query.Filters, filters...)
+	}
+	query.Keyword = strings.Join(keywords, " ")
+	query.Syntax = false
+	return query, nil
+}
+
+// keywordAlternatives returns the alternatives of an OR between keyword
+// terms, phrases or groups of them.
+func keywordAlternatives(n QueryNode) ([]string, bool) {
+	if n.Kind != QueryOr || n.Field != "" {
+		return nil, false
+	}
+	out := make([]string, 0, len(n.Children))
+	for _, child := range n.Children {
+		text, ok := keywordText(child)
+		if !ok {
+			return nil, false
+		}
+		out = append(out, text)
+	}
+	return out, true
+}
+
+func keywordText(n QueryNode) (string, bool) {
+	if n.Field != "" || n.Occur != "" {
+		return "", false
+	}
+	switch n.Kind {
+	case QueryTerm:
+		return n.Text, true
+	case QueryPhrase:
+		return n.String(), true
+	case QueryGroup:
+		parts := make([]string, 0, len(n.Children))
+		for _, child := range n.Children {
+			text, ok := keywordText(child)
+			if !ok {
+				return "", false
+			}
+			parts = append(parts, text)
+		}
+		return strings.Join(parts, " "), true
+	}
+	return "", false
+}
+
+// queryFilters turns a field clause into filters.
+func queryFilters(n QueryNode, schema Fields) ([]Filter, error) {
+	var out []Filter
+	switch n.Kind {
+	case QueryTerm, QueryPhrase:
+		if n.Field == "" {
+			return nil, &SyntaxError{Pos: n.Pos, Msg: "keyword terms can only be combined with field clauses by AND"}
+		}
+		value := queryLiteral(n.Text)
+		_, str := value.(string)
+		field, ok := schema.Lookup(n.Field)
+		text := ok && field.Type == FieldText || len(schema) == 0 && (str || n.Kind == QueryPhrase)
+		filter := Filter{Field: n.Field, Op: FilterEq, Value: value}
+		if text {
+			filter = Filter{Field: n.Field, Op: FilterText, Value: n.Text}
+		}
+		if n.Kind == QueryTerm && n.Wildcard {
+			head := strings.TrimSuffix(n.Text, "*")
+			prefix := head != n.Text && !strings.ContainsAny(head, "*?")
+			switch {
+			case prefix && text:
+				// a text field prefixes its last term, not the whole value
+				filter = Filter{Field: n.Field, Op: FilterText, Value: n.Text}
+			case prefix:
+				filter = Filter{Field: n.Field, Op: FilterPrefix, Value: head}
+			default:
+				filter = Filter{Field: n.Field, Op: FilterWildcard, Value: n.Text}
+			}
+		}
+		out = []Filter{filter}
+	case QueryCompare:
+		ops := map[string]string{">": FilterGt, ">=": FilterGte, "<": FilterLt, "<=": FilterLte}
+		out = []Filter{{Field: n.Field, Op: ops[n.Op], Value: queryLiteral(n.Text)}}
+	case QueryRange:
+		from, to := n.From != "*", n.To != "*"
+		switch {
+		case !from && !to:
+			out = []Filter{{Field: n.Field, Op: FilterExists, Value: true}}
+		case from && to && n.FromIncl && n.ToIncl:
+			out = []Filter{{Field: n.Field, Op: FilterRange, Min: queryLiteral(n.From), Max: queryLiteral(n.To)}}
+		default:
+			if from {
+				op := FilterGt
+				if n.FromIncl {
+					op = FilterGte
+				}
+				out = append(out, Filter{Field: n.Field, Op: op, Value: queryLiteral(n.From)})
+			}
+			if to {
+				op := FilterLt
+				if n.ToIncl {
+					op = FilterLte
+				}
+				out = append(out, Filter{Field: n.Field, Op: op, Value: queryLiteral(n.To)})
+			}
+		}
+	case QueryGroup:
+		for _, child := range n.Children {
+			filters, err := queryFilters(child, schema)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, filters...)
+		}
+	case QueryOr:
+		alternatives := make([]Filter, 0, len(n.Children))
+		values := make([]Any, 0, len(n.Children))
+		for _, child := range n.Children {
+			filters, err := queryFilters(child, schema)
+			if err != nil {
+				return nil, err
+			}
+			if len(filters) == 1 {
+				alternatives = append(alternatives, filters[0])
+				if f := filters[0]; f.Op == FilterEq && f.Field == n.Field && n.Field != "" {
+					values = append(values, f.Value)
+				}
+			} else {
+				alternatives = append(alternatives, Filter{Op: FilterAnd, Filters: filters})
+			}
+		}
+		if len(values) == len(alternatives) {
+			out = []Filter{{Field: n.Field, Op: FilterIn, Values: values}}
+		} else {
+			out = []Filter{{Op: FilterOr, Filters: alternatives}}
+		}
+	}
+	if n.Occur == "-" {
+		out = []Filter{{Op: FilterNot, Filters: out}}
+	}
+	return out, nil
+}
+
+// queryLiteral types the numbers and booleans of a query string.
+func queryLiteral(s string) Any {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	if b, err := strconv.ParseBool(s); err == nil && (s == "true" || s == "false") {
+		return b
+	}
+	return s
+}
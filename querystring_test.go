@@ -0,0 +1,261 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/infrago/base"
+)
+
+func TestParseQueryStringRoundTrip(t *testing.T) {
+	for _, s := range []string{
+		`title:golang -draft tag:(api OR sdk) price:[10 TO 50]`,
+		`a b OR c d`,
+		`(x OR y) z +must -"bad phrase"~2`,
+		`date:{2020-01-01 TO *] n:>=5 NOT status:closed`,
+		`name:jo* path:a?c x\:y`,
+		`-(a b) tag:(api)`,
+	} {
+		node, err := ParseQueryString(s)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		out := node.String()
+		again, err := ParseQueryString(out)
+		if err != nil || again.String() != out {
+			t.Fatalf("%s formatted as %s, which parses to %s, %v", s, out, again.String(), err)
+		}
+	}
+}
+
+func TestParseQueryStringRangeSpaces(t *testing.T) {
+	for _, s := range []string{"n:[10 TO 50]", "n:[10 TO\t50]", "n:[10\tTO\n50]", "n:[ 10  TO  50 ]"} {
+		node, err := ParseQueryString(s)
+		if err != nil {
+			t.Fatalf("%q: %v", s, err)
+		}
+		if node.Kind != QueryRange || node.From != "10" || node.To != "50" {
+			t.Fatalf("%q parsed as %+v", s, node)
+		}
+	}
+	if _, err := ParseQueryString("n:[10 TOP 50]"); err == nil {
+		t.Fatal("TOP accepted as TO")
+	}
+}
+
+func TestParseQueryStringErrors(t *testing.T) {
+	cases := []struct {
+		input string
+		pos   int
+	}{
+		{`a OR`, 2},
+		{`(a b`, 0},
+		{`"abc`, 0},
+		{`x:[1 2]`, 5},
+		{`x:[1 TO 2`, 2},
+		{`title:`, 6},
+		{`OR a`, 0},
+	}
+	for _, one := range cases {
+		_, err := ParseQueryString(one.input)
+		var syntax *SyntaxError
+		if !errors.As(err, &syntax) {
+			t.Fatalf("%q: %v, want a SyntaxError", one.input, err)
+		}
+		if syntax.Pos != one.pos {
+			t.Errorf("%q: error at %d (%s), want %d", one.input, syntax.Pos, syntax.Msg, one.pos)
+		}
+	}
+	for _, s := range []string{`- a`, `a~2`, `x:(a y:b)`} {
+		if _, err := ParseQueryString(s); err == nil {
+			t.Errorf("%q parsed", s)
+		}
+	}
+}
+
+func TestApplySyntax(t *testing.T) {
+	query, err := applySyntax(BuildQuery(`golang -draft +fast tag:(api OR sdk) price:[10 TO 50] "go lang"`, Map{"$syntax": true}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Keyword != "golang" || len(query.Excluded) != 1 || len(query.Required) != 1 || len(query.Phrases) != 1 {
+		t.Fatalf("clauses split as %+v", query)
+	}
+	if len(query.Filters) != 2 || query.Filters[0].Op != FilterOr || query.Filters[1].Op != FilterRange {
+		t.Fatalf("filters %+v", query.Filters)
+	}
+
+	query, err = applySyntax(BuildQuery(`(a OR "b c") go (d e OR f) -(x OR y)`, Map{"$syntax": true}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Keyword != "go" || len(query.Should) != 2 || len(query.Excluded) != 2 {
+		t.Fatalf("clauses split as %+v", query)
+	}
+	if got := fmt.Sprint(query.Should); got != `[[a "b c"] [d e f]]` {
+		t.Fatalf("should %s", got)
+	}
+	if _, err := applySyntax(BuildQuery(`a OR title:b`, Map{"$syntax": true}), nil); err == nil {
+		t.Fatal("OR between a keyword term and a field clause accepted")
+	}
+}
+
+func TestApplySyntaxSchemaless(t *testing.T) {
+	query, err := applySyntax(BuildQuery(`title:golang tag:(api OR sdk) n:5 name:jo*`, Map{"$syntax": true}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(query.Filters) != 4 {
+		t.Fatalf("filters %+v", query.Filters)
+	}
+	if f := query.Filters[0]; f.Op != FilterText || f.Value != "golang" {
+		t.Fatalf("string term is %+v, want text", f)
+	}
+	if f := query.Filters[2]; f.Op != FilterEq || f.Value != int64(5) {
+		t.Fatalf("number term is %+v, want eq", f)
+	}
+	if f := query.Filters[3]; f.Op != FilterText || f.Value != "jo*" {
+		t.Fatalf("prefix term is %+v, want a text prefix", f)
+	}
+
+	c := newConn(t)
+	c.Upsert("qs", []Map{
+		{"id": "1", "title": "The Golang guide", "tag": "api docs", "name": "Mary Jones"},
+		{"id": "2", "title": "golang", "tag": "web", "name": "John"},
+		{"id": "3", "title": "rust", "tag": "sdk", "name": "Joe"},
+	})
+	query, _ = applySyntax(BuildQuery(`title:golang tag:(api OR sdk) name:jo*`, Map{"$syntax": true}), nil)
+	res, err := c.Search("qs", query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 1 || res.Hits[0].ID != "1" {
+		t.Fatalf("matched %v, want 1", hitIDs(res.Hits))
+	}
+}
+
+func TestApplySyntaxTextPrefix(t *testing.T) {
+	schema, err := parseFields(Map{"title": Map{"type": FieldText}, "code": Map{"type": FieldKeyword}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newConn(t)
+	c.SyncIndex("qs", Index{Schema: schema})
+	c.Upsert("qs", []Map{
+		{"id": "1", "title": "Learning golang", "code": "gopher"},
+		{"id": "2", "title": "go fast", "code": "rust"},
+		{"id": "3", "title": "rust book", "code": "algo"},
+	})
+	for _, one := range []struct {
+		keyword string
+		want    string
+	}{
+		{`title:go*`, "12"},
+		{`title:gol*`, "1"},
+		{`title:"learning gol*"`, "1"},
+		{`title:"golang learn*"`, ""},
+		{`code:go*`, "1"},
+	} {
+		query, err := applySyntax(BuildQuery(one.keyword, Map{"$syntax": true, "$sort": "id"}), schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, _ := c.Search("qs", query)
+		if got := hitIDs(res.Hits); got != one.want {
+			t.Errorf("%s matched %s, want %s", one.keyword, got, one.want)
+		}
+	}
+}
+
+func TestSyntaxSearchOr(t *testing.T) {
+	c := newConn(t)
+	c.Upsert("qs", []Map{
+		{"id": "1", "title": "golang and rust"},
+		{"id": "2", "title": "rust"},
+		{"id": "3", "title": "golang"},
+		{"id": "4", "title": "python"},
+		{"id": "5", "title": "golang draft"},
+	})
+	search := func(keyword string, args ...Any) Result {
+		t.Helper()
+		query, err := applySyntax(BuildQuery(keyword, append(args, Map{"$syntax": true})...), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := c.Search("qs", query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	res := search(`golang OR rust`)
+	if res.Total != 4 || res.Hits[0].ID != "1" {
+		t.Fatalf("matched %v, want 1 first of 4", hitIDs(res.Hits))
+	}
+	res = search(`(golang OR rust) -draft`)
+	if res.Total != 3 || res.Hits[0].ID != "1" {
+		t.Fatalf("matched %v, want 1 first of 3", hitIDs(res.Hits))
+	}
+	res = search(`golang (rust OR draft)`, Map{"$sort": "id"})
+	if got := hitIDs(res.Hits); got != "15" {
+		t.Fatalf("matched %s, want 15", got)
+	}
+	res = search(`-(golang OR rust)`)
+	if got := hitIDs(res.Hits); got != "4" {
+		t.Fatalf("matched %s, want 4", got)
+	}
+}
+
+func TestApplySyntaxTextFields(t *testing.T) {
+	schema, err := parseFields(Map{
+		"title": Map{"type": FieldText},
+		"tag":   Map{"type": FieldKeyword},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err := applySyntax(BuildQuery(`title:golang title:"api guide" tag:Go`, Map{"$syntax": true}), schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := []string{FilterText, FilterText, FilterEq}
+	if len(query.Filters) != len(ops) {
+		t.Fatalf("filters %+v", query.Filters)
+	}
+	for i, op := range ops {
+		if query.Filters[i].Op != op {
+			t.Fatalf("filter %d is %s, want %s", i, query.Filters[i].Op, op)
+		}
+	}
+
+	c := newConn(t)
+	c.SyncIndex("qs", Index{Schema: schema})
+	c.Upsert("qs", []Map{
+		{"id": "1", "title": "The Golang API guide", "tag": "Go"},
+		{"id": "2", "title": "golang", "tag": "go lang"},
+		{"id": "3", "title": "guide to the api", "tag": "Go"},
+	})
+	res, err := c.Search("qs", query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 1 || res.Hits[0].ID != "1" {
+		t.Fatalf("matched %v, want 1", res.Hits)
+	}
+}
+
+func TestSyntaxSearch(t *testing.T) {
+	c := newConn(t)
+	c.Upsert("qs", []Map{
+		{"id": "1", "title": "golang api", "tag": "api", "price": 20},
+		{"id": "2", "title": "golang draft", "tag": "sdk", "price": 30},
+		{"id": "3", "title": "golang", "tag": "web", "price": 30},
+		{"id": "4", "title": "golang", "tag": "sdk", "price": 80},
+	})
+	query, _ := applySyntax(BuildQuery(`golang -draft tag:(api OR sdk) price:[10 TO 50]`, Map{"$syntax": true}), nil)
+	res, _ := c.Search("qs", query)
+	if res.Total != 1 || res.Hits[0].ID != "1" {
+		t.Fatalf("matched %v, want 1", res.Hits)
+	}
+}
@@ -0,0 +1,204 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// write consistencies, the replicas that must accept a write for it to
+// succeed.
+const (
+	ConsistencyAll    = "all"
+	ConsistencyQuorum = "quorum"
+	ConsistencyAny    = "any"
+)
+
+// ReplicaError reports a write that did not reach its consistency, Errors
+// holds the failure of each replica by instance name.
+type ReplicaError struct {
+	Op          string
+	Index       string
+	Consistency string
+	Acked       int
+	Required    int
+	Errors      map[string]error
+}
+
+func (e *ReplicaError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+": "+e.Errors[name].Error())
+	}
+	return fmt.Sprintf("%s on search index %s reached %d of %d required replicas: %s",
+		e.Op, e.Index, e.Acked, e.Required, strings.Join(parts, "; "))
+}
+
+func (e *ReplicaError) Unwrap() []error {
+	out := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		out = append(out, err)
+	}
+	return out
+}
+
+func checkConsistency(consistency string) error {
+	switch consistency {
+	case "", ConsistencyAll, ConsistencyQuorum, ConsistencyAny:
+		return nil
+	}
+	return fmt.Errorf("unknown consistency %s", consistency)
+}
+
+// required is how many of n replicas must accept a write.
+func required(consistency string, n int) int {
+	switch consistency {
+	case ConsistencyAny:
+		return min(1, n)
+	case ConsistencyQuorum:
+		return n/2 + 1
+	}
+	return n
+}
+
+// replicasLocked is the instances holding an index: its routed
+// Instances, or Index.Replicas instances walked from the hash ring. The
+// ring holds every configured instance, so that replica sets do not
+// change with health.
+func (m *Module) replicasLocked(index string) []*Instance {
+	if insts := m.routeLocked(index); len(insts) > 0 {
+		return insts
+	}
+	first := m.locateLocked(index)
+	if first == nil {
+		return nil
+	}
+	out := []*Instance{first}
+	n := min(m.indexes[index].Replicas, len(m.instances))
+	if len(out) >= n {
+		return out
+	}
+	seen := map[string]struct{}{first.Name: {}}
+	add := func(inst *Instance) {
+		if _, ok := seen[inst.Name]; ok || len(out) >= n {
+			return
+		}
+		seen[inst.Name] = struct{}{}
+		out = append(out, inst)
+	}
+	if m.hashring != nil {
+		for i := 1; len(out) < n && i <= 4*len(m.instances); i++ {
+			if inst, ok := m.instances[m.hashring.Locate(fmt.Sprintf("%s#%d", index, i))]; ok {
+				add(inst)
+			}
+		}
+	}
+	names := make([]string, 0, len(m.instances))
+	for name := range m.instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(m.instances[name])
+	}
+	return out
+}
+
+// write runs fn on every replica of the index and checks the replicas
+// that accepted it against the index consistency.
+func (m *Module) write(ctx context.Context, op, index string, fn func(context.Context, *Instance) error) error {
+	m.mutex.RLock()
+	insts := m.replicasLocked(index)
+	consistency := m.indexes[index].Consistency
+	m.mutex.RUnlock()
+	return m.writeReplicas(ctx, insts, consistency, op, index, fn)
+}
+
+func (m *Module) writeReplicas(ctx context.Context, insts []*Instance, consistency, op, index string, fn func(context.Context, *Instance) error) error {
+	if len(insts) == 0 {
+		return fmt.Errorf("search is not ready")
+	}
+	if len(insts) == 1 {
+		inst := insts[0]
+		return m.call(ctx, inst, op, index, func(ctx context.Context) error {
+			return fn(ctx, inst)
+		})
+	}
+
+	errs := make([]error, len(insts))
+	var wg sync.WaitGroup
+	for i, inst := range insts {
+		wg.Go(func() {
+			errs[i] = m.call(ctx, inst, op, index, func(ctx context.Context) error {
+				return fn(ctx, inst)
+			})
+		})
+	}
+	wg.Wait()
+
+	failed := map[string]error{}
+	for i, err := range errs {
+		if err != nil {
+			failed[insts[i].Name] = err
+		}
+	}
+	acked, need := len(insts)-len(failed), required(consistency, len(insts))
+	if acked >= need {
+		return nil
+	}
+	if consistency == "" {
+		consistency = ConsistencyAll
+	}
+	return &ReplicaError{Op: op, Index: index, Consistency: consistency, Acked: acked, Required: need, Errors: failed}
+}
+
+// read runs fn on the replicas of the index in turn until one succeeds,
+// healthy ones first. Only transient errors fail over and count toward
+// unhealthy_threshold of the replica, an open circuit fails over only,
+// others such as an invalid query or cursor are returned at once, as is a
+// done ctx.
+func (m *Module) read(ctx context.Context, op, index string, fn func(context.Context, *Instance) error) error {
+	m.mutex.RLock()
+	insts := m.replicasLocked(index)
+	m.mutex.RUnlock()
+	if len(insts) == 0 {
+		return fmt.Errorf("search is not ready")
+	}
+	healthy := make(map[*Instance]bool, len(insts))
+	for _, inst := range insts {
+		healthy[inst] = inst.healthy()
+	}
+	sort.SliceStable(insts, func(i, j int) bool {
+		return healthy[insts[i]] && !healthy[insts[j]]
+	})
+
+	var err error
+	for _, inst := range insts {
+		err = m.call(ctx, inst, op, index, func(ctx context.Context) error {
+			return fn(ctx, inst)
+		})
+		if err == nil {
+			inst.recordRead(nil)
+			return nil
+		}
+		if ctx != nil && ctx.Err() != nil {
+			return err
+		}
+		if errors.Is(err, ErrCircuitOpen) {
+			continue
+		}
+		if !retryable(inst.conn, err) {
+			return err
+		}
+		inst.recordRead(err)
+	}
+	return err
+}
@@ -0,0 +1,170 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/util"
+)
+
+type tempErr struct{}
+
+func (tempErr) Error() string   { return "temporary failure" }
+func (tempErr) Temporary() bool { return true }
+
+// brokenConn fails every write, and every search with err.
+type brokenConn struct {
+	Connection
+	err      error
+	searches *atomic.Int32
+}
+
+func (b brokenConn) Upsert(index string, rows []Map) error { return errors.New("boom") }
+
+func (b brokenConn) Search(index string, query Query) (Result, error) {
+	if b.searches != nil {
+		b.searches.Add(1)
+	}
+	return Result{}, b.err
+}
+
+func replicaModule(t *testing.T, conns map[string]Connection) *Module {
+	m := &Module{instances: map[string]*Instance{}, weights: map[string]int{}, indexes: map[string]Index{}}
+	for name, conn := range conns {
+		m.instances[name] = &Instance{Name: name, conn: conn}
+		m.weights[name] = 1
+	}
+	m.hashring = util.NewHashRing(m.weights)
+	return m
+}
+
+func TestRequired(t *testing.T) {
+	cases := []struct {
+		consistency string
+		n, need     int
+	}{
+		{"", 3, 3},
+		{ConsistencyAll, 2, 2},
+		{ConsistencyQuorum, 3, 2},
+		{ConsistencyQuorum, 4, 3},
+		{ConsistencyQuorum, 1, 1},
+		{ConsistencyAny, 3, 1},
+		{ConsistencyAny, 0, 0},
+	}
+	for _, one := range cases {
+		if got := required(one.consistency, one.n); got != one.need {
+			t.Errorf("required(%q, %d) = %d, want %d", one.consistency, one.n, got, one.need)
+		}
+	}
+	if err := checkConsistency("most"); err == nil {
+		t.Fatal("unknown consistency accepted")
+	}
+}
+
+func TestReplicaWrites(t *testing.T) {
+	a, b, c := newConn(t), newConn(t), newConn(t)
+	m := replicaModule(t, map[string]Connection{"a": a, "b": brokenConn{Connection: b}, "c": c})
+	m.RegisterIndex("quorum", Index{Replicas: 3, Consistency: " Quorum "})
+	m.RegisterIndex("all", Index{Instances: []string{"b", "a"}})
+	m.RegisterIndex("any", Index{Instances: []string{"b", "c"}, Consistency: ConsistencyAny})
+	m.RegisterIndex("many", Index{Replicas: 10})
+
+	if got := m.ListIndexes()["quorum"]; len(got) != 3 {
+		t.Fatalf("quorum replicas %v, want 3", got)
+	}
+	if got := m.ListIndexes()["many"]; len(got) != 3 {
+		t.Fatalf("replicas %v, want as many as instances", got)
+	}
+	m.RegisterIndex("pair", Index{Replicas: 2})
+	pair := fmt.Sprint(m.ListIndexes()["pair"])
+	m.instances["a"].down.Store(true)
+	m.instances["c"].down.Store(true)
+	if got := fmt.Sprint(m.ListIndexes()["pair"]); got != pair {
+		t.Fatalf("replicas %s turned into %s with health", pair, got)
+	}
+	m.instances["a"].down.Store(false)
+	m.instances["c"].down.Store(false)
+
+	// every replica that accepted a write holds it
+	if err := m.Upsert("quorum", Map{"id": "1", "t": "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if docIDs(a, "quorum") != "1" || docIDs(c, "quorum") != "1" {
+		t.Fatalf("quorum write reached a: %q, c: %q", docIDs(a, "quorum"), docIDs(c, "quorum"))
+	}
+	if err := m.Upsert("any", Map{"id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := m.Upsert("all", Map{"id": "1", "t": "x"})
+	var re *ReplicaError
+	if !errors.As(err, &re) || re.Acked != 1 || re.Required != 2 || re.Consistency != ConsistencyAll || re.Errors["b"] == nil {
+		t.Fatalf("%v, want a ReplicaError from b", err)
+	}
+	if !strings.Contains(err.Error(), "b: boom") {
+		t.Fatalf("error %q does not name the replica", err)
+	}
+	// the replicas that accepted it keep it
+	if docIDs(a, "all") != "1" {
+		t.Fatal("write was not applied on a")
+	}
+}
+
+func TestReplicaReads(t *testing.T) {
+	a, b := newConn(t), newConn(t)
+	searches := &atomic.Int32{}
+	m := replicaModule(t, map[string]Connection{"a": a, "b": brokenConn{Connection: b, err: tempErr{}, searches: searches}})
+	m.RegisterIndex("docs", Index{Instances: []string{"b", "a"}, Consistency: ConsistencyAny})
+	if err := m.Upsert("docs", Map{"id": "1", "t": "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// transient errors fail over, the replica is tried last once they
+	// reach the threshold
+	b0 := m.instances["b"]
+	b0.Config.HealthInterval = 50 * time.Millisecond
+	for i := range DefaultUnhealthyThreshold {
+		if m.pickInst("docs").Name != "b" {
+			t.Fatalf("replica b skipped after %d failures", i)
+		}
+		res, err := m.Search("docs", "x")
+		if err != nil || res.Total != 1 {
+			t.Fatalf("failover search %+v %v", res, err)
+		}
+	}
+	if b0.down.Load() || m.pickInst("docs").Name != "a" || m.Health()["b"].Healthy {
+		t.Fatal("failed replica is still picked first")
+	}
+	if _, err := m.Search("docs", "x"); err != nil || searches.Load() != DefaultUnhealthyThreshold {
+		t.Fatalf("%v after %d searches on b, want the healthy replica tried first", err, searches.Load())
+	}
+	// without a Pinger the failures expire, and a success clears them
+	time.Sleep(60 * time.Millisecond)
+	b0.conn = b
+	if _, err := m.Search("docs", "x"); err != nil || searches.Load() != DefaultUnhealthyThreshold {
+		t.Fatalf("search after recovery %v", err)
+	}
+	if health := m.Health()["b"]; !health.Healthy || health.ReadFailures != 0 {
+		t.Fatalf("recovered replica %+v", health)
+	}
+
+	// other errors are the answer, no other replica is asked
+	m.instances["b"].conn = brokenConn{Connection: b, err: errors.New("invalid query"), searches: searches}
+	m.instances["a"].conn = brokenConn{Connection: a, searches: &atomic.Int32{}}
+	if _, err := m.Search("docs", "x"); err == nil || err.Error() != "invalid query" {
+		t.Fatalf("%v, want the error of b", err)
+	}
+	if m.Health()["b"].ReadFailures != 0 || m.instances["a"].conn.(brokenConn).searches.Load() != 0 {
+		t.Fatal("a query error failed over")
+	}
+	// the only replica left is used even when it is down
+	m.instances["a"].down.Store(true)
+	if inst := m.pickInst("docs"); inst == nil {
+		t.Fatal("no replica picked while all are down")
+	}
+}
@@ -0,0 +1,252 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/infra"
+)
+
+// retry defaults for policies that enable retries without tuning them.
+const (
+	DefaultRetryBackoff    = 100 * time.Millisecond
+	DefaultRetryMaxBackoff = 2 * time.Second
+	DefaultBreakerCooldown = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without calling the connection while the
+// circuit breaker of its instance is open.
+var ErrCircuitOpen = errors.New("search circuit breaker is open")
+
+type (
+	// RetryPolicy retries a connection call on errors the driver reports as
+	// retryable, waiting Backoff before the second attempt and doubling it
+	// up to MaxBackoff, less a random Jitter fraction. Attempts counts the
+	// first call, 1 or less disables retries.
+	RetryPolicy struct {
+		Attempts   int
+		Backoff    time.Duration
+		MaxBackoff time.Duration
+		Jitter     float64
+	}
+
+	// BreakerPolicy opens the circuit of an instance after Failures
+	// consecutive failed calls, calls then fail fast with ErrCircuitOpen
+	// for Cooldown, after which one trial call closes it again on success.
+	// Zero Failures disables it.
+	BreakerPolicy struct {
+		Failures int
+		Cooldown time.Duration
+	}
+
+	// breaker is the circuit state of an instance.
+	breaker struct {
+		mutex     sync.Mutex
+		failures  int
+		openUntil time.Time
+		trial     bool
+	}
+)
+
+// RegisterRetryPolicy sets the retry policy of an operation (search,
+// count, suggest, scan, upsert, delete, clear, sync or synonyms), or of all
+// operations without one when op is empty.
+func (m *Module) RegisterRetryPolicy(op string, policy RetryPolicy) {
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		panic(fmt.Sprintf("invalid search retry policy %s: jitter %g is out of [0, 1]", op, policy.Jitter))
+	}
+	m.policyMutex.Lock()
+	defer m.policyMutex.Unlock()
+	if m.retries == nil {
+		m.retries = make(map[string]RetryPolicy)
+	}
+	if infra.Override() {
+		m.retries[op] = policy
+	} else if _, ok := m.retries[op]; !ok {
+		m.retries[op] = policy
+	}
+}
+
+// RegisterBreakerPolicy sets the circuit breaker of every instance.
+func (m *Module) RegisterBreakerPolicy(policy BreakerPolicy) {
+	m.policyMutex.Lock()
+	defer m.policyMutex.Unlock()
+	if infra.Override() || m.circuit == nil {
+		m.circuit = &policy
+	}
+}
+
+func (m *Module) retryPolicy(op string) RetryPolicy {
+	m.policyMutex.RLock()
+	defer m.policyMutex.RUnlock()
+	policy, ok := m.retries[op]
+	if !ok {
+		policy = m.retries[""]
+	}
+	if policy.Attempts > 1 {
+		if policy.Backoff <= 0 {
+			policy.Backoff = DefaultRetryBackoff
+		}
+		if policy.MaxBackoff <= 0 {
+			policy.MaxBackoff = DefaultRetryMaxBackoff
+		}
+	}
+	return policy
+}
+
+func (m *Module) circuitPolicy() BreakerPolicy {
+	m.policyMutex.RLock()
+	defer m.policyMutex.RUnlock()
+	var policy BreakerPolicy
+	if m.circuit != nil {
+		policy = *m.circuit
+	}
+	if policy.Failures > 0 && policy.Cooldown <= 0 {
+		policy.Cooldown = DefaultBreakerCooldown
+	}
+	return policy
+}
+
+// configRetry reads [search.retry], with per operation sections like
+// [search.retry.search], and [search.breaker].
+func (m *Module) configRetry(cfg Map) {
+	if one, ok := cfg["retry"].(Map); ok {
+		m.RegisterRetryPolicy("", parseRetryPolicy(one, RetryPolicy{}))
+		base := m.retryPolicy("")
+		for op, vv := range one {
+			if sub, ok := vv.(Map); ok {
+				m.RegisterRetryPolicy(op, parseRetryPolicy(sub, base))
+			}
+		}
+	}
+	if one, ok := cfg["breaker"].(Map); ok {
+		policy := BreakerPolicy{}
+		if v, ok := toInt(one["failures"]); ok {
+			policy.Failures = v
+		}
+		if v, ok := one["cooldown"]; ok {
+			policy.Cooldown = parseDuration(v)
+		}
+		m.RegisterBreakerPolicy(policy)
+	}
+}
+
+func parseRetryPolicy(one Map, policy RetryPolicy) RetryPolicy {
+	if v, ok := toInt(one["attempts"]); ok {
+		policy.Attempts = v
+	}
+	if v, ok := one["backoff"]; ok {
+		policy.Backoff = parseDuration(v)
+	}
+	if v, ok := one["max_backoff"]; ok {
+		policy.MaxBackoff = parseDuration(v)
+	}
+	if v, ok := toFloat(one["jitter"]); ok {
+		policy.Jitter = v
+	}
+	return policy
+}
+
+// delay is the wait before the attempt after the given one.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, p.MaxBackoff)
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// retryable reports whether a call failed transiently: on timeouts, and
+// as the connection says when it implements Retrier, otherwise for errors
+// that report themselves temporary.
+func retryable(conn Connection, err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if r, ok := conn.(Retrier); ok {
+		return r.Retryable(err)
+	}
+	var temp interface{ Temporary() bool }
+	return errors.As(err, &temp) && temp.Temporary()
+}
+
+// call runs fn on an instance through its circuit breaker, retrying it
+// with the retry policy of op. Config.Timeout bounds the whole call, the
+// retries and the waits between them included. Only retryable errors
+// count as failures for the breaker.
+func (m *Module) call(ctx context.Context, inst *Instance, op, index string, fn func(context.Context) error) error {
+	policy, circuit := m.retryPolicy(op), m.circuitPolicy()
+	return inst.run(ctx, op, index, func(ctx context.Context) error {
+		for attempt := 1; ; attempt++ {
+			if !inst.breaker.allow(circuit, time.Now()) {
+				return fmt.Errorf("search instance %s: %w", inst.Name, ErrCircuitOpen)
+			}
+			err := fn(ctx)
+			transient := retryable(inst.conn, err)
+			inst.breaker.done(circuit, err, transient, time.Now())
+			if err == nil || !transient || attempt >= policy.Attempts {
+				return err
+			}
+
+			timer := time.NewTimer(policy.delay(attempt))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+	})
+}
+
+// allow reports whether a call may go through, letting a single trial
+// call through once an open circuit has cooled down.
+func (b *breaker) allow(policy BreakerPolicy, now time.Time) bool {
+	if policy.Failures <= 0 {
+		return true
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if now.Before(b.openUntil) || b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// done records the outcome of a call: a success closes the circuit, a
+// transient failure counts towards opening it, or opens it again after a
+// trial. Other errors say nothing about the instance, a trial ending with
+// one lets the next call try again.
+func (b *breaker) done(policy BreakerPolicy, err error, transient bool, now time.Time) {
+	if policy.Failures <= 0 {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch {
+	case err == nil:
+		b.failures, b.openUntil = 0, time.Time{}
+	case transient:
+		b.failures++
+		if b.trial || b.failures >= policy.Failures {
+			b.openUntil = now.Add(policy.Cooldown)
+		}
+	}
+	b.trial = false
+}
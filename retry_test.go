@@ -0,0 +1,181 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/infrago/base"
+)
+
+// retryConn fails its first fail searches with err, tempErr by default.
+type retryConn struct {
+	Connection
+	calls *atomic.Int32
+	fail  int32
+	err   error
+	delay time.Duration
+}
+
+func (r retryConn) Search(index string, query Query) (Result, error) {
+	time.Sleep(r.delay)
+	if r.calls.Add(1) <= r.fail {
+		if r.err != nil {
+			return Result{}, r.err
+		}
+		return Result{}, tempErr{}
+	}
+	return Result{Total: 7}, nil
+}
+
+func retryModule(conn retryConn, cfg Config) *Module {
+	return &Module{
+		instances: map[string]*Instance{"a": {Name: "a", Config: cfg, conn: conn}},
+		indexes:   map[string]Index{},
+	}
+}
+
+func TestRetry(t *testing.T) {
+	calls := &atomic.Int32{}
+	m := retryModule(retryConn{Connection: newConn(t), calls: calls, fail: 2}, Config{})
+	m.RegisterRetryPolicy("search", RetryPolicy{Attempts: 3, Backoff: time.Millisecond, Jitter: 0.5})
+	res, err := m.Search("x", "")
+	if err != nil || res.Total != 7 || calls.Load() != 3 {
+		t.Fatalf("%+v %v after %d calls, want a result after 3", res, err, calls.Load())
+	}
+
+	// errors that are not transient are returned at once
+	calls.Store(0)
+	m.instances["a"].conn = retryConn{Connection: newConn(t), calls: calls, fail: 5, err: errors.New("bad query")}
+	if _, err := m.Search("x", ""); err == nil || calls.Load() != 1 {
+		t.Fatalf("%v after %d calls, want the error after 1", err, calls.Load())
+	}
+}
+
+func TestRetryTimeoutCoversCall(t *testing.T) {
+	calls := &atomic.Int32{}
+	conn := retryConn{Connection: newConn(t), calls: calls, fail: 100, delay: 20 * time.Millisecond}
+	m := retryModule(conn, Config{Timeout: 50 * time.Millisecond})
+	m.RegisterRetryPolicy("search", RetryPolicy{Attempts: 10, Backoff: 5 * time.Millisecond})
+
+	start := time.Now()
+	_, err := m.Search("x", "")
+	var te *TimeoutError
+	if !errors.As(err, &te) || te.Timeout != 50*time.Millisecond {
+		t.Fatalf("%v, want a TimeoutError after 50ms", err)
+	}
+	if took := time.Since(start); took > 150*time.Millisecond {
+		t.Fatalf("call took %s, the timeout was applied per attempt", took)
+	}
+	if n := calls.Load(); n >= 10 {
+		t.Fatalf("%d attempts within the timeout", n)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	calls := &atomic.Int32{}
+	m := retryModule(retryConn{Connection: newConn(t), calls: calls, fail: 100}, Config{})
+	m.RegisterRetryPolicy("search", RetryPolicy{Attempts: 2, Backoff: time.Millisecond})
+	m.RegisterBreakerPolicy(BreakerPolicy{Failures: 4, Cooldown: 30 * time.Millisecond})
+	m.Search("x", "")
+	m.Search("x", "")
+	if _, err := m.Search("x", ""); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("%v, want the circuit open", err)
+	}
+	if calls.Load() != 4 {
+		t.Fatalf("%d calls reached the connection, want 4", calls.Load())
+	}
+
+	// a failed trial opens the circuit again
+	time.Sleep(40 * time.Millisecond)
+	calls.Store(0)
+	m.Search("x", "")
+	if calls.Load() != 1 {
+		t.Fatalf("%d trial calls, want 1", calls.Load())
+	}
+	if _, err := m.Search("x", ""); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("%v after a failed trial, want the circuit open", err)
+	}
+
+	// a successful trial closes it
+	time.Sleep(40 * time.Millisecond)
+	m.instances["a"].conn = retryConn{Connection: newConn(t), calls: calls}
+	if _, err := m.Search("x", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Search("x", ""); err != nil {
+		t.Fatalf("%v after a successful trial", err)
+	}
+}
+
+func TestBreakerTrialError(t *testing.T) {
+	policy := BreakerPolicy{Failures: 1, Cooldown: time.Millisecond}
+	b := &breaker{}
+	now := time.Now()
+	b.allow(policy, now)
+	b.done(policy, tempErr{}, true, now)
+	if b.allow(policy, now) {
+		t.Fatal("open circuit let a call through")
+	}
+
+	// an error that is not transient neither closes the circuit nor
+	// keeps the trial taken
+	later := now.Add(2 * time.Millisecond)
+	if !b.allow(policy, later) {
+		t.Fatal("no trial after the cooldown")
+	}
+	b.done(policy, context.Canceled, false, later)
+	if b.openUntil.IsZero() {
+		t.Fatal("a trial without success closed the circuit")
+	}
+	if !b.allow(policy, later) {
+		t.Fatal("no new trial after an inconclusive one")
+	}
+	b.done(policy, nil, false, later)
+	if !b.openUntil.IsZero() || b.failures != 0 {
+		t.Fatal("a successful trial did not close the circuit")
+	}
+}
+
+func TestRetryConfig(t *testing.T) {
+	m := &Module{}
+	m.configRetry(Map{
+		"retry":   Map{"attempts": 2, "upsert": Map{"attempts": 5}},
+		"breaker": Map{"failures": 3, "cooldown": "1s"},
+	})
+	if p := m.retryPolicy("upsert"); p.Attempts != 5 || p.Backoff != DefaultRetryBackoff {
+		t.Fatalf("upsert policy %+v", p)
+	}
+	if p := m.retryPolicy("count"); p.Attempts != 2 {
+		t.Fatalf("count policy %+v", p)
+	}
+	if p := m.circuitPolicy(); p.Failures != 3 || p.Cooldown != time.Second {
+		t.Fatalf("breaker policy %+v", p)
+	}
+	m.RegisterBreakerPolicy(BreakerPolicy{Failures: 5})
+	if p := m.circuitPolicy(); p.Failures != 5 || p.Cooldown != DefaultBreakerCooldown {
+		t.Fatalf("breaker policy %+v after override", p)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	conn := newConn(t)
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{tempErr{}, true},
+		{&TimeoutError{Op: "search"}, true},
+		{context.Canceled, false},
+		{ErrCircuitOpen, false},
+		{errors.New("bad query"), false},
+	}
+	for _, one := range cases {
+		if got := retryable(conn, one.err); got != one.want {
+			t.Errorf("retryable(%v) = %v, want %v", one.err, got, one.want)
+		}
+	}
+}
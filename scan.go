@@ -0,0 +1,91 @@
+package search
+
+import (
+	"context"
+	"iter"
+	"time"
+
+	. "github.com/infrago/base"
+)
+
+// scanBatch is the page size Scan reads from the connection.
+const scanBatch = 500
+
+// scanScroll keeps the scroll of a scan alive between two pages.
+const scanScroll = time.Minute
+
+// Scan walks every hit matching the query in sort order, reading a page at
+// a time with a scroll, or cursors, when the connection supports them and
+// offsets otherwise. Offset and Limit of the query are ignored, a Cursor
+// resumes a previous scan. Pages fail over between the replicas of the
+// index like other reads, except once a scroll is open: it only lives on
+// the replica that opened it. Iteration stops at the first error.
+func (m *Module) Scan(index, keyword string, args ...Any) iter.Seq2[Hit, error] {
+	return m.ScanContext(context.Background(), index, keyword, args...)
+}
+
+// ScanContext is Scan with every page read under ctx and Config.Timeout.
+func (m *Module) ScanContext(ctx context.Context, index, keyword string, args ...Any) iter.Seq2[Hit, error] {
+	return func(yield func(Hit, error) bool) {
+		query, err := m.buildQuery(index, keyword, args...)
+		if err != nil {
+			yield(Hit{}, err)
+			return
+		}
+		query.Offset, query.Limit, query.Scroll = 0, scanBatch, 0
+		fresh := query.Cursor == ""
+
+		// owner holds the scroll of the scan, if any
+		var owner *Instance
+		for {
+			var res Result
+			var caps Capabilities
+			page := func(ctx context.Context, inst *Instance) error {
+				caps = inst.conn.Capabilities()
+				if err := checkCapabilities(caps, query); err != nil {
+					return err
+				}
+				one := query
+				if caps.Scroll && fresh {
+					one.Scroll = scanScroll
+				}
+				var err error
+				res, err = connSearch(ctx, inst.conn, inst.physical(index), one)
+				if err == nil && one.Scroll > 0 {
+					owner = inst
+				}
+				return err
+			}
+			if owner != nil {
+				err = m.call(ctx, owner, "scan", index, func(ctx context.Context) error {
+					return page(ctx, owner)
+				})
+			} else {
+				err = m.read(ctx, "scan", index, page)
+			}
+			if err == nil {
+				res, err = m.normalizeResult(index, res)
+			}
+			if err != nil {
+				yield(Hit{}, err)
+				return
+			}
+			for _, hit := range res.Hits {
+				if !yield(hit, nil) {
+					return
+				}
+			}
+			if caps.Cursor || caps.Scroll {
+				if res.Cursor == "" {
+					return
+				}
+				query.Cursor = res.Cursor
+				continue
+			}
+			if len(res.Hits) < query.Limit {
+				return
+			}
+			query.Offset += len(res.Hits)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package search
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/infrago/base"
+)
+
+// offsetConn pages with offsets only and counts its searches.
+type offsetConn struct {
+	Connection
+	searches *atomic.Int32
+}
+
+func (o offsetConn) Capabilities() Capabilities {
+	caps := o.Connection.Capabilities()
+	caps.Cursor, caps.Scroll = false, false
+	return caps
+}
+
+func (o offsetConn) Search(index string, query Query) (Result, error) {
+	o.searches.Add(1)
+	return o.Connection.Search(index, query)
+}
+
+func scanModule(conn Connection) *Module {
+	return &Module{
+		instances: map[string]*Instance{"a": {Name: "a", conn: conn}},
+		indexes:   map[string]Index{},
+	}
+}
+
+func TestScan(t *testing.T) {
+	c := newConn(t)
+	rows := make([]Map, 0, 1203)
+	for i := range 1203 {
+		rows = append(rows, Map{"id": fmt.Sprintf("%04d", i), "n": i})
+	}
+	c.Upsert("q", rows)
+
+	searches := &atomic.Int32{}
+	for name, conn := range map[string]Connection{"cursor": c, "offset": offsetConn{c, searches}} {
+		m := scanModule(conn)
+		n, last := 0, 1<<30
+		for hit, err := range m.Scan("q", "", Map{"$sort": "-n", "$limit": 10, "$offset": 5}) {
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			v := hit.Payload["n"].(int)
+			if v >= last {
+				t.Fatalf("%s: %d after %d", name, v, last)
+			}
+			last = v
+			// hits are copies, changing them leaves the index alone
+			hit.Payload["n"] = -1
+			n++
+		}
+		if n != 1203 {
+			t.Fatalf("%s scan yielded %d hits, want 1203", name, n)
+		}
+	}
+	if got := searches.Load(); got != 3 {
+		t.Fatalf("offset scan read %d pages, want 3", got)
+	}
+	if res, _ := c.Search("q", BuildQuery("", Map{"n": 5})); res.Hits[0].Payload["n"] != 5 {
+		t.Fatal("scan changed the indexed payload")
+	}
+}
+
+func TestScanStop(t *testing.T) {
+	c := newConn(t)
+	for i := range 1000 {
+		c.Upsert("q", []Map{{"id": fmt.Sprint(i)}})
+	}
+	searches := &atomic.Int32{}
+	m := scanModule(offsetConn{c, searches})
+	n := 0
+	for _, err := range m.Scan("q", "") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n++; n == 3 {
+			break
+		}
+	}
+	if searches.Load() != 1 {
+		t.Fatalf("scan read %d pages after stopping in the first", searches.Load())
+	}
+
+	var errs int
+	for _, err := range m.Scan("q", "", Map{"x": Map{"$regex": "("}}) {
+		if err == nil {
+			t.Fatal("scan with an invalid filter yielded a hit")
+		}
+		errs++
+	}
+	if errs != 1 {
+		t.Fatalf("scan yielded %d errors, want 1", errs)
+	}
+}
+
+func TestScanReplicas(t *testing.T) {
+	a, b := newConn(t), newConn(t)
+	rows := make([]Map, 0, 1203)
+	for i := range 1203 {
+		rows = append(rows, Map{"id": fmt.Sprintf("%04d", i), "n": i})
+	}
+	a.Upsert("q", rows)
+	b.Upsert("q", rows)
+
+	// the first page fails over, the scroll it opens serves the others
+	searches := &atomic.Int32{}
+	m := replicaModule(t, map[string]Connection{"a": brokenConn{Connection: a, err: tempErr{}, searches: searches}, "b": b})
+	m.RegisterIndex("q", Index{Instances: []string{"a", "b"}})
+	n := 0
+	for hit, err := range m.Scan("q", "", Map{"$sort": "n"}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := hit.Payload["n"].(int); v != n {
+			t.Fatalf("hit %d is %d", n, v)
+		}
+		n++
+	}
+	if n != 1203 || searches.Load() != 1 {
+		t.Fatalf("scan yielded %d hits after %d searches on a, want 1203 after 1", n, searches.Load())
+	}
+	b.scrollMutex.Lock()
+	scrolls := len(b.scrolls)
+	b.scrollMutex.Unlock()
+	if scrolls != 1 {
+		t.Fatalf("scan kept %d scrolls, want one for its pages", scrolls)
+	}
+}
@@ -0,0 +1,111 @@
+package search
+
+import "strings"
+
+// stopWordLists are the built-in stop words per language.
+var stopWordLists = map[string][]string{
+	"en": englishStopWords,
+	"zh": chineseStopWords,
+	"ja": japaneseStopWords,
+	"ko": koreanStopWords,
+}
+
+var stopWordLanguages = map[string]string{
+	"english":  "en",
+	"chinese":  "zh",
+	"japanese": "ja",
+	"korean":   "ko",
+}
+
+// StopWords returns the built-in stop words of a language such as "en",
+// "zh" or "zh-cn", nil when there is no list for it.
+func StopWords(language string) []string {
+	lang := strings.ToLower(strings.TrimSpace(language))
+	if alias, ok := stopWordLanguages[lang]; ok {
+		lang = alias
+	}
+	if base, _, ok := strings.Cut(lang, "-"); ok {
+		lang = base
+	}
+	words, ok := stopWordLists[lang]
+	if !ok {
+		return nil
+	}
+	return append([]string{}, words...)
+}
+
+// WithStopWords returns a copy of the analyzer that also drops words. The
+// stop filter goes right after the normalizing filters (lowercase, ascii
+// folding and other stop filters), and the words are normalized by them.
+func (a Analyzer) WithStopWords(words ...string) Analyzer {
+	if len(words) == 0 {
+		return a
+	}
+	pos := 0
+	for i, filter := range a.TokenFilters {
+		switch filter.(type) {
+		case LowercaseFilter, ASCIIFoldingFilter, StopFilter:
+			pos = i + 1
+		}
+	}
+	set := make(map[string]struct{}, len(words))
+	for _, word := range words {
+		tokens := []Token{{Term: strings.TrimSpace(word)}}
+		for _, filter := range a.TokenFilters[:pos] {
+			if filter != nil {
+				tokens = filter.Filter(tokens)
+			}
+		}
+		for _, token := range tokens {
+			if token.Term != "" {
+				set[token.Term] = struct{}{}
+			}
+		}
+	}
+	filters := make([]TokenFilter, 0, len(a.TokenFilters)+1)
+	filters = append(filters, a.TokenFilters[:pos]...)
+	filters = append(filters, StopFilter{Words: set})
+	filters = append(filters, a.TokenFilters[pos:]...)
+	a.TokenFilters = filters
+	return a
+}
+
+// withoutStopWords returns a copy of the analyzer without its stop filters,
+// used when a query consists of stop words only.
+func (a Analyzer) withoutStopWords() Analyzer {
+	filters := make([]TokenFilter, 0, len(a.TokenFilters))
+	for _, filter := range a.TokenFilters {
+		if _, ok := filter.(StopFilter); !ok {
+			filters = append(filters, filter)
+		}
+	}
+	a.TokenFilters = filters
+	return a
+}
+
+func (a Analyzer) hasStopWords() bool {
+	for _, filter := range a.TokenFilters {
+		if _, ok := filter.(StopFilter); ok {
+			return true
+		}
+	}
+	return false
+}
+
+var chineseStopWords = []string{
+	"的", "地", "得", "了", "着", "过", "和", "与", "及", "或", "是", "在", "就",
+	"都", "而", "也", "又", "把", "被", "让", "给", "对", "从", "向", "于", "之",
+	"其", "啊", "吗", "呢", "吧", "呀", "并且", "或者", "以及", "而且", "但是",
+	"因为", "所以", "如果", "虽然", "这个", "那个", "这些", "那些", "一个",
+}
+
+var japaneseStopWords = []string{
+	"の", "に", "は", "を", "が", "で", "と", "も", "へ", "や", "から", "まで",
+	"より", "です", "ます", "でした", "ました", "そして", "しかし", "これ",
+	"それ", "あれ", "この", "その", "あの",
+}
+
+var koreanStopWords = []string{
+	"그리고", "그러나", "하지만", "그래서", "또는", "및", "그", "이", "저",
+	"것", "수", "등",
+}
@@ -0,0 +1,85 @@
+package search
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	. "github.com/infrago/base"
+)
+
+func TestStopWordLists(t *testing.T) {
+	for _, lang := range []string{"en", "English", "zh-CN", "ja", "ko"} {
+		if len(StopWords(lang)) == 0 {
+			t.Errorf("no stop words for %s", lang)
+		}
+	}
+	if words := StopWords("fr"); words != nil {
+		t.Errorf("stop words for fr: %v", words)
+	}
+	words := StopWords("en")
+	words[0] = "changed"
+	if StopWords("en")[0] == "changed" {
+		t.Fatal("StopWords returns the built-in list itself")
+	}
+	if !slices.Contains(StopWords("zh"), "的") {
+		t.Fatal("的 is not a chinese stop word")
+	}
+}
+
+func TestWithStopWords(t *testing.T) {
+	standard, _ := module.Analyzer(AnalyzerStandard)
+	analyzer := standard.WithStopWords(" Foo ", "Café")
+	tokens := analyzer.Analyze("foo bar CAFE baz")
+	if len(tokens) != 2 || tokens[0].Term != "bar" || tokens[0].Position != 1 || tokens[1].Position != 3 {
+		t.Fatalf("tokens %v, want bar and baz at their positions", tokens)
+	}
+	// the registered analyzer is left alone
+	if got := strings.Join(standard.Terms("foo"), " "); got != "foo" {
+		t.Fatalf("standard analyzer terms %q", got)
+	}
+	if got := module.IndexAnalyzer(Index{StopWords: []string{"foo"}}).Terms("foo bar"); len(got) != 1 {
+		t.Fatalf("index stop words not applied: %v", got)
+	}
+}
+
+func TestStopWordSearch(t *testing.T) {
+	c := newConn(t)
+	c.SyncIndex("e", Index{StopWords: []string{"Foo"}})
+	c.Upsert("e", []Map{{"id": "1", "title": "foo bar"}, {"id": "2", "title": "foo"}, {"id": "3", "title": "baz"}})
+	cases := []struct {
+		keyword string
+		ids     string
+	}{
+		{"foo bar", "1"},
+		// a query of stop words only falls back to them
+		{"foo", "21"},
+		{`"foo"`, "21"},
+	}
+	for _, one := range cases {
+		res, err := c.Search("e", BuildQuery(one.keyword))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hitIDs(res.Hits); got != one.ids {
+			t.Errorf("search %s matched %s, want %s", one.keyword, got, one.ids)
+		}
+	}
+
+	zh := newConn(t)
+	zh.SyncIndex("z", Index{Language: "zh"})
+	zh.Upsert("z", []Map{{"id": "1", "title": "我的手机"}, {"id": "2", "title": "你的电脑"}, {"id": "3", "title": "目的地"}})
+	if res, _ := zh.Search("z", BuildQuery("的")); len(res.Hits) != 2 {
+		t.Fatalf("的 matched %v, want the two documents using it as a word", res.Hits)
+	}
+	if res, _ := zh.Search("z", BuildQuery("我的")); len(res.Hits) != 1 {
+		t.Fatalf("我的 matched %v", res.Hits)
+	}
+
+	en := newConn(t)
+	en.SyncIndex("en", Index{Language: "en"})
+	en.Upsert("en", []Map{{"id": "1", "title": "To be or not to be"}, {"id": "2", "title": "The thing"}})
+	if res, _ := en.Search("en", BuildQuery(`"to be or not to be"`)); len(res.Hits) != 1 || res.Hits[0].ID != "1" {
+		t.Fatalf("stop word phrase matched %v", res.Hits)
+	}
+}
@@ -0,0 +1,87 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ParseSynonyms parses synonym rules in the usual text form, "tv,
+// television" declares equivalent terms and "phone, cell => mobile phone"
+// a one way expansion.
+func ParseSynonyms(rules ...string) ([]Synonym, error) {
+	out := make([]Synonym, 0, len(rules))
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "" || strings.HasPrefix(rule, "#") {
+			continue
+		}
+		synonym := Synonym{}
+		if input, terms, ok := strings.Cut(rule, "=>"); ok {
+			synonym.Input = splitSynonymTerms(input)
+			synonym.Terms = splitSynonymTerms(terms)
+		} else {
+			synonym.Terms = splitSynonymTerms(rule)
+		}
+		if err := checkSynonym(synonym); err != nil {
+			return nil, err
+		}
+		out = append(out, synonym)
+	}
+	return out, nil
+}
+
+func splitSynonymTerms(s string) []string {
+	out := make([]string, 0)
+	for _, one := range strings.Split(s, ",") {
+		if one = strings.TrimSpace(one); one != "" {
+			out = append(out, one)
+		}
+	}
+	return out
+}
+
+func checkSynonym(synonym Synonym) error {
+	if len(synonym.Terms) == 0 {
+		return fmt.Errorf("synonym %v has no terms", synonym.Input)
+	}
+	if len(synonym.Input) == 0 && len(synonym.Terms) < 2 {
+		return fmt.Errorf("synonym %v needs at least two equivalent terms", synonym.Terms)
+	}
+	return nil
+}
+
+// UpdateSynonyms replaces the synonyms of an index at runtime. Connections
+// implementing SynonymUpdater apply them without re-indexing, the others
+// get the index again through SyncIndex.
+func (m *Module) UpdateSynonyms(index string, synonyms []Synonym) error {
+	for _, synonym := range synonyms {
+		if err := checkSynonym(synonym); err != nil {
+			return err
+		}
+	}
+
+	m.mutex.Lock()
+	def, ok := m.indexes[index]
+	if !ok {
+		m.mutex.Unlock()
+		return fmt.Errorf("search index %s not found", index)
+	}
+	def.Synonyms = append([]Synonym{}, synonyms...)
+	m.indexes[index] = def
+	if !m.opened {
+		m.mutex.Unlock()
+		return nil
+	}
+	insts := m.replicasLocked(index)
+	m.mutex.Unlock()
+
+	// the connections are called without the lock, so searches and health
+	// checks go on while they re-index.
+	return m.writeReplicas(context.Background(), insts, def.Consistency, "synonyms", index, func(ctx context.Context, inst *Instance) error {
+		if updater, ok := inst.conn.(SynonymUpdater); ok {
+			return updater.UpdateSynonyms(inst.physical(index), def.Synonyms)
+		}
+		return inst.conn.SyncIndex(inst.physical(index), inst.physicalIndex(def))
+	})
+}
@@ -0,0 +1,101 @@
+package search
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/infrago/base"
+	"github.com/infrago/util"
+)
+
+func TestParseSynonyms(t *testing.T) {
+	synonyms, err := ParseSynonyms("tv, television", "phone, cell => mobile phone", "", "# comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(synonyms) != 2 {
+		t.Fatalf("parsed %d rules, want 2", len(synonyms))
+	}
+	if got := synonyms[1]; len(got.Input) != 2 || len(got.Terms) != 1 || got.Terms[0] != "mobile phone" {
+		t.Fatalf("one way rule parsed as %+v", got)
+	}
+	if _, err := ParseSynonyms("tv"); err == nil {
+		t.Fatal("a single equivalent term parsed")
+	}
+	if _, err := ParseSynonyms("tv =>"); err == nil {
+		t.Fatal("a rule without terms parsed")
+	}
+}
+
+func TestSynonymExpansion(t *testing.T) {
+	synonyms, _ := ParseSynonyms("tv, television", "手机 => 移动电话")
+	c := newConn(t)
+	c.SyncIndex("en", Index{Language: "en", Synonyms: synonyms[:1]})
+	c.Upsert("en", []Map{
+		{"id": "1", "title": "Smart television sets"},
+		{"id": "2", "title": "TV remote"},
+		{"id": "3", "title": "radio"},
+	})
+	if res, _ := c.Search("en", BuildQuery("tv")); res.Total != 2 {
+		t.Fatalf("tv matched %d, want 2", res.Total)
+	}
+	if err := c.UpdateSynonyms("en", nil); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := c.Search("en", BuildQuery("tv")); res.Total != 1 {
+		t.Fatalf("tv matched %d without synonyms, want 1", res.Total)
+	}
+
+	c.SyncIndex("zh", Index{Language: "zh", Synonyms: synonyms[1:]})
+	c.Upsert("zh", []Map{{"id": "1", "title": "新款移动电话上市"}, {"id": "2", "title": "手机壳"}})
+	if res, _ := c.Search("zh", BuildQuery("手机")); res.Total != 2 {
+		t.Fatalf("手机 matched %d, want 2", res.Total)
+	}
+	// one way rules do not expand back
+	if res, _ := c.Search("zh", BuildQuery("移动电话")); res.Total != 1 {
+		t.Fatalf("移动电话 matched %d, want 1", res.Total)
+	}
+}
+
+// lockingUpdater reads the module while it applies synonyms, as a slow
+// connection lets other callers do.
+type lockingUpdater struct {
+	*defaultConnection
+	module *Module
+}
+
+func (u lockingUpdater) UpdateSynonyms(index string, synonyms []Synonym) error {
+	done := make(chan struct{})
+	go func() {
+		u.module.ListIndexes()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		return errors.New("module locked while updating synonyms")
+	}
+	return u.defaultConnection.UpdateSynonyms(index, synonyms)
+}
+
+func TestUpdateSynonymsUnlocked(t *testing.T) {
+	m := &Module{
+		instances: map[string]*Instance{},
+		weights:   map[string]int{"a": 1},
+		indexes:   map[string]Index{},
+		opened:    true,
+	}
+	m.instances["a"] = &Instance{Name: "a", conn: lockingUpdater{newConn(t), m}}
+	m.hashring = util.NewHashRing(m.weights)
+	m.RegisterIndex("docs", Index{})
+	if err := m.UpdateSynonyms("docs", []Synonym{{Terms: []string{"tv", "television"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.indexes["docs"].Synonyms; len(got) != 1 {
+		t.Fatalf("index synonyms = %v", got)
+	}
+	if err := m.UpdateSynonyms("missing", nil); err == nil {
+		t.Fatal("updated a missing index")
+	}
+}